@@ -2,6 +2,8 @@ package backr
 
 import (
 	"context"
+	"io"
+	"time"
 )
 
 type API interface {
@@ -10,8 +12,21 @@ type API interface {
 
 type PrivateAPI interface {
 	Listen(ctx context.Context) error
+	// Shutdown stops the API gracefully, waiting for the running requests and jobs until ctx is done
+	Shutdown(ctx context.Context) error
 }
 
 type PrivateAPIClient interface {
-	Backup(projectName string) (*UploadedArchiveInfo, error)
+	StartBackup(projectName string) (*Job, error)
+	GetJob(id string) (*Job, error)
+	CancelJob(id string) (*Job, error)
+	StreamJobLogs(id string, w io.Writer) error
+	PauseProject(projectName string, until time.Time) error
+	ResumeProject(projectName string) error
+	SkipNextBackup(projectName string) error
+	Prune(projectName string, dryRun bool) ([]PruneDecision, error)
+	GetRun(projectName string, id int) (*Run, error)
+	VerifyRun(projectName string, id int) ([]VerifyResult, error)
+	RunRestoreTest(projectName string) (*RestoreTestResult, error)
+	GetArchiveLocation(projectName string, id int, destination string) (*ArchiveLocation, error)
 }
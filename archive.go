@@ -1,7 +1,49 @@
 package backr
 
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+)
+
 // Executor defines some methods necessary to execute a backup
 type Executor interface {
 	GetOutputFileExtension() string
-	Execute(workingDir string, output string) error
+	// GetCommand returns the command executed to create the archive
+	GetCommand(output string) []string
+	// Execute runs the archiver, killing it if ctx is cancelled.
+	// The messages of the archiver (everything except the archive itself) are written to logs.
+	Execute(ctx context.Context, workingDir string, output string, logs io.Writer) error
+}
+
+// ExecutionPlan describes what a backup execution would do
+type ExecutionPlan struct {
+	Project  string   `json:"project"`
+	Dir      string   `json:"dir"`
+	Archiver string   `json:"archiver"`
+	Command  []string `json:"command"`
+	Bucket   string   `json:"bucket,omitempty"`
+	Object   string   `json:"object,omitempty"`
+	// Destinations lists the names of the destinations receiving the archive
+	Destinations []string `json:"destinations,omitempty"`
+}
+
+// ExecutionError is returned when an archiver fails, with the output it has written (set by the caller capturing it)
+type ExecutionError struct {
+	Err    error
+	Output string
+}
+
+func (e ExecutionError) Error() string {
+	lines := strings.Split(strings.TrimSpace(e.Output), "\n")
+	lastLine := strings.TrimSpace(lines[len(lines)-1])
+	if lastLine == "" {
+		return e.Err.Error()
+	}
+	return fmt.Sprintf("%v (last output: %s)", e.Err, lastLine)
+}
+
+func (e ExecutionError) Unwrap() error {
+	return e.Err
 }
@@ -1,73 +1,300 @@
 package archive
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 	"webup/backr"
+	"webup/backr/logging"
+	"webup/backr/randstr"
 	"webup/backr/s3"
 
-	log "github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus"
 )
 
-// ExecuteBackup performs backup execution
-func ExecuteBackup(project backr.Project, backup backr.Backup, returnBackupURL bool, settings backr.Settings) (*backr.UploadedArchiveInfo, error) {
+var log = logging.Logger(logging.Archive)
 
-	tmpDir := "._tmp"
+// Options customizes a backup execution
+type Options struct {
+	// ReturnBackupURL generates a presigned URL for the uploaded archive
+	ReturnBackupURL bool
+	// Output receives the messages of the archiver (can be nil)
+	Output io.Writer
+	// Progress is called each time the execution reaches a new step (can be nil)
+	Progress func(progress backr.JobProgress)
+}
 
-	if _, err := os.Stat(tmpDir); os.IsNotExist(err) {
-		os.MkdirAll(tmpDir, os.ModePerm)
+func (o Options) notify(progress backr.JobProgress) {
+	if o.Progress != nil {
+		o.Progress(progress)
 	}
+}
 
-	var executor backr.Executor
-
-	// archiver
+// newExecutor returns the executor matching the archiver of a project
+func newExecutor(project backr.Project) backr.Executor {
 	if project.Archiver.Type == "stdout" {
-		executor = Stdout{
+		return Stdout{
 			OutputFileExtension: project.Archiver.OutputFileExtension,
 			Command:             project.Archiver.Command,
 		}
-	} else {
-		executor = Pliz{}
 	}
 
-	outputFile := fmt.Sprintf("%d.%s", time.Now().Unix(), executor.GetOutputFileExtension())
+	return Pliz{}
+}
+
+// Plan describes what ExecuteBackup would do, without executing anything
+func Plan(project backr.Project, settings backr.Settings) backr.ExecutionPlan {
+	executor := newExecutor(project)
+
+	plan := backr.ExecutionPlan{
+		Project:  project.Name,
+		Dir:      project.Dir,
+		Archiver: project.Archiver.Type,
+		Command:  executor.GetCommand("<output>." + executor.GetOutputFileExtension()),
+	}
+
+	if settings.S3 != nil {
+		plan.Bucket = settings.S3.Bucket
+		// the templates are validated with the settings and the specs: the name is only illustrative here
+		plan.Object, _ = s3.ObjectName(project, backr.Backup{}, executor.GetOutputFileExtension(), time.Now(), settings)
+		for _, destination := range settings.GetDestinations() {
+			plan.Destinations = append(plan.Destinations, destination.Name)
+		}
+	}
+
+	return plan
+}
+
+// uploadRate returns the function giving the upload bandwidth limit of a project (nil if unlimited)
+func uploadRate(project backr.Project, settings backr.Settings) func() int64 {
+	limit := settings.UploadRateLimit
+	if project.UploadRateLimit != "" {
+		// the limit is validated when parsing the spec
+		limit, _ = backr.ParseRateLimit(project.UploadRateLimit)
+	}
+
+	if limit.IsUnlimited() {
+		return nil
+	}
+
+	location := project.TimeSpec(settings.TimeSpec).GetLocation()
+	return func() int64 {
+		return limit.RateAt(time.Now(), location)
+	}
+}
+
+// objectTags returns the tags of the object storing an archive
+func objectTags(project backr.Project, backup backr.Backup, objects backr.S3ObjectSettings) map[string]string {
+	tags := map[string]string{}
+	for key, value := range objects.Tags {
+		tags[key] = value
+	}
+
+	if objects.Tagging {
+		tags["project"] = project.Name
+		if backup.Checksum != "" {
+			tags["backup"] = backup.Checksum
+		}
+		if host, err := os.Hostname(); err == nil {
+			tags["host"] = host
+		}
+	}
+
+	return tags
+}
+
+// ExecuteBackup performs backup execution
+func ExecuteBackup(ctx context.Context, project backr.Project, backup backr.Backup, options Options, settings backr.Settings) (*backr.UploadedArchiveInfo, error) {
+
+	tmpDir := "._tmp"
+
+	if _, err := os.Stat(tmpDir); os.IsNotExist(err) {
+		os.MkdirAll(tmpDir, os.ModePerm)
+	}
+
+	executor := newExecutor(project)
+
+	// the backups of several projects, or of the same project, may run at the same time
+	outputFile := fmt.Sprintf("%s-%d-%s.%s", strings.ReplaceAll(project.Name, "/", "_"), time.Now().Unix(), strings.ToLower(randstr.SecureRandomAlphaString(8)), executor.GetOutputFileExtension())
 	output, err := filepath.Abs(filepath.Join(tmpDir, outputFile))
 	if err != nil {
 		return nil, err
 	}
 
+	logs := options.Output
+	if logs == nil {
+		logs = ioutil.Discard
+	}
+
 	// execute the command
-	err = executor.Execute(project.Dir, output)
+	options.notify(backr.JobProgressArchiving)
+	startedAt := time.Now()
+	err = executor.Execute(ctx, project.Dir, output, logs)
 	if err != nil {
-		return nil, err
+		// do not keep a partial archive
+		os.Remove(output)
+		return nil, backr.ExecutionError{Err: err}
 	}
 
-	var info *backr.UploadedArchiveInfo
+	finishedAt := time.Now()
+
+	size, sum, err := backr.FileChecksum(output)
+	if err != nil {
+		os.Remove(output)
+		return nil, fmt.Errorf("unable to read the archive: %v", err)
+	}
+	info := &backr.UploadedArchiveInfo{Size: size}
+
+	// the size is checked before the upload: an archive failing the check is not uploaded
+	sizeCheck := project.GetSizeCheck()
+	info.SizeAnomaly = sizeCheck.Check(size, project.Runs)
+	if info.SizeAnomaly != "" && sizeCheck.Fails() {
+		os.Remove(output)
+		return info, fmt.Errorf("abnormal archive size: %s", info.SizeAnomaly)
+	}
 
 	// upload to S3
 	if settings.S3 != nil {
-		log.WithFields(log.Fields{
-			"name":      project.Name,
+		log.WithFields(logrus.Fields{
+			"project":   project.Name,
 			"s3_upload": true,
 			"file":      output,
 		}).Debugln("Backup file created")
 
-		info, err = s3.Upload(project, backup, output, executor.GetOutputFileExtension(), returnBackupURL, *settings.S3)
+		objectName, err := s3.ObjectName(project, backup, executor.GetOutputFileExtension(), time.Now(), settings)
 		if err != nil {
+			os.Remove(output)
 			return nil, err
 		}
 
+		manifest := newManifest(project, backup, executor, objectName, settings)
+		manifest.StartedAt = startedAt
+		manifest.FinishedAt = finishedAt
+		manifest.Size = size
+		manifest.SHA256 = sum
+
+		options.notify(backr.JobProgressUploading)
+		uploaded, err := replicate(ctx, project, backup, output, manifest, options, settings)
+		// the size and its check are known before the upload
+		uploaded.Size = info.Size
+		uploaded.SizeAnomaly = info.SizeAnomaly
+		info = uploaded
+
 		// delete the file
 		os.Remove(output)
+
+		if err != nil {
+			return info, err
+		}
 	} else {
-		log.WithFields(log.Fields{
-			"name":      project.Name,
+		log.WithFields(logrus.Fields{
+			"project":   project.Name,
 			"s3_upload": false,
 			"file":      output,
 		}).Debugln("Backup file created")
 	}
 
+	options.notify(backr.JobProgressDone)
+
 	return info, nil
 }
+
+// newManifest returns the manifest of an archive stored as the given object, without the description of the archive file
+func newManifest(project backr.Project, backup backr.Backup, executor backr.Executor, name string, settings backr.Settings) backr.ArchiveManifest {
+	objects := project.ObjectSettings(settings.S3Objects)
+	host, _ := os.Hostname()
+
+	return backr.ArchiveManifest{
+		Version:      backr.ManifestVersion,
+		Archive:      name,
+		Project:      project.Name,
+		Host:         host,
+		BackrVersion: backr.Version,
+		Archiver:     project.Archiver.Type,
+		Command:      executor.GetCommand("<output>." + executor.GetOutputFileExtension()),
+		Backup:       backup.Checksum,
+		Encryption:   objects.Encryption,
+		KMSKeyID:     objects.KMSKeyID,
+		Compression:  backr.Compression(executor.GetOutputFileExtension()),
+		TTL:          backup.TTL,
+		LockMode:     objects.LockMode,
+	}
+}
+
+// replicate uploads an archive and its manifest to every destination, and applies the replication policy to the results.
+// The information about the uploads is returned even if the policy is not satisfied.
+func replicate(ctx context.Context, project backr.Project, backup backr.Backup, file string, manifest backr.ArchiveManifest, options Options, settings backr.Settings) (*backr.UploadedArchiveInfo, error) {
+	name := manifest.Archive
+	destinations := settings.GetDestinations()
+	objects := project.ObjectSettings(settings.S3Objects)
+	uploadOptions := s3.UploadOptions{
+		ReturnBackupURL: options.ReturnBackupURL,
+		Rate:            uploadRate(project, settings),
+		Object:          objects,
+		Tags:            objectTags(project, backup, objects),
+	}
+	if backup.TTL > 0 {
+		uploadOptions.RetainUntil = time.Now().AddDate(0, 0, backup.TTL)
+		expiresAt := uploadOptions.RetainUntil
+		manifest.ExpiresAt = &expiresAt
+	}
+
+	info := backr.UploadedArchiveInfo{
+		Name: name,
+	}
+
+	succeeded := 0
+	for _, destination := range destinations {
+		if ctx.Err() != nil {
+			info.Destinations = append(info.Destinations, backr.DestinationResult{
+				Destination: destination.Name,
+				Error:       ctx.Err().Error(),
+			})
+			continue
+		}
+
+		result := backr.DestinationResult{
+			Destination: destination.Name,
+		}
+
+		uploaded, err := s3.Upload(ctx, project, name, file, uploadOptions, destination)
+		if err == nil {
+			// an archive without its manifest is not self-describing: the destination is failed
+			err = s3.UploadManifest(ctx, manifest, uploadOptions, destination)
+		}
+		if err != nil {
+			log.WithFields(logrus.Fields{
+				"project":     project.Name,
+				"destination": destination.Name,
+				"err":         err,
+			}).Warnln("Unable to upload the archive to a destination")
+
+			result.Error = err.Error()
+		} else {
+			result.Success = true
+			succeeded++
+
+			// the first available replica is returned
+			if info.URL == "" {
+				info.URL = uploaded.URL
+			}
+		}
+
+		info.Destinations = append(info.Destinations, result)
+	}
+
+	if succeeded == 0 {
+		return &info, fmt.Errorf("unable to upload the archive to any destination: %s", info.Destinations[0].Error)
+	}
+
+	if succeeded < len(destinations) && settings.ReplicationPolicy != backr.ReplicationRequireOne {
+		return &info, fmt.Errorf("unable to upload the archive to %d of %d destinations", len(destinations)-succeeded, len(destinations))
+	}
+
+	return &info, nil
+}
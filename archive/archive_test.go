@@ -0,0 +1,76 @@
+package archive
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"webup/backr"
+	"webup/backr/s3/s3test"
+)
+
+func TestExecuteBackupConcurrently(t *testing.T) {
+	// the archives are written into ._tmp, under the working directory
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	standIn := s3test.NewStandIn(t)
+	destination := standIn.Settings()
+	settings := backr.NewDefaultSettings()
+	settings.S3 = &destination
+
+	// the archivers run during the same second, each project writes an archive of its own size
+	sizes := map[string]int{"small": 1000, "large": 50000}
+	infos := map[string]*backr.UploadedArchiveInfo{}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	for name, size := range sizes {
+		project := backr.Project{
+			Name: name,
+			Dir:  t.TempDir(),
+			Archiver: backr.Archiver{
+				Type:                "stdout",
+				OutputFileExtension: "bin",
+				Command:             []string{"sh", "-c", fmt.Sprintf("sleep 0.2; head -c %d /dev/zero", size)},
+			},
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			info, err := ExecuteBackup(context.Background(), project, backr.Backup{}, Options{}, settings)
+			if err != nil {
+				t.Errorf("%s: %v", project.Name, err)
+				return
+			}
+
+			mu.Lock()
+			infos[project.Name] = info
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	for name, size := range sizes {
+		info, ok := infos[name]
+		if !ok {
+			continue
+		}
+
+		if info.Size != int64(size) {
+			t.Errorf("%s: expected an archive of %d bytes, got %d", name, size, info.Size)
+		}
+		if uploaded, _ := standIn.Object("bucket/" + info.Name); uploaded != int64(size) {
+			t.Errorf("%s: expected an uploaded archive of %d bytes, got %d", name, size, uploaded)
+		}
+	}
+}
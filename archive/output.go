@@ -0,0 +1,43 @@
+package archive
+
+import (
+	"sync"
+)
+
+// OutputBuffer keeps the last bytes written to it, to capture the output of an archiver with a bounded size
+type OutputBuffer struct {
+	mu        sync.Mutex
+	size      int
+	data      []byte
+	truncated bool
+}
+
+// NewOutputBuffer returns a buffer keeping at most size bytes
+func NewOutputBuffer(size int) *OutputBuffer {
+	return &OutputBuffer{size: size}
+}
+
+// Write implements io.Writer, dropping the oldest bytes when the buffer is full
+func (b *OutputBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.data = append(b.data, p...)
+	if len(b.data) > b.size {
+		b.data = append([]byte{}, b.data[len(b.data)-b.size:]...)
+		b.truncated = true
+	}
+
+	return len(p), nil
+}
+
+// String returns the captured output
+func (b *OutputBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.truncated {
+		return "[... output truncated]\n" + string(b.data)
+	}
+	return string(b.data)
+}
@@ -1,7 +1,8 @@
 package archive
 
 import (
-	"os"
+	"context"
+	"io"
 	"os/exec"
 )
 
@@ -14,13 +15,19 @@ func (pliz Pliz) GetOutputFileExtension() string {
 	return "tar.gz"
 }
 
+// GetCommand implements Executor interface
+func (pliz Pliz) GetCommand(output string) []string {
+	return []string{"pliz", "backup", "-q", "--files", "--db", "-o", output}
+}
+
 // Execute implements Executor interface
-func (pliz Pliz) Execute(workingDir string, output string) error {
+func (pliz Pliz) Execute(ctx context.Context, workingDir string, output string, logs io.Writer) error {
 
-	cmd := exec.Command("pliz", "backup", "-q", "--files", "--db", "-o", output)
+	command := pliz.GetCommand(output)
+	cmd := exec.CommandContext(ctx, command[0], command[1:]...)
 	cmd.Dir = workingDir
-	cmd.Stdout = nil
-	cmd.Stderr = os.Stderr
+	cmd.Stdout = logs
+	cmd.Stderr = logs
 
 	return cmd.Run()
 }
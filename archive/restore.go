@@ -0,0 +1,54 @@
+package archive
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"webup/backr"
+)
+
+// ExecuteRestoreTest restores a downloaded archive into a scratch directory and runs the assertions of a restore drill.
+// The cleanup command is executed in any case.
+func ExecuteRestoreTest(ctx context.Context, project backr.Project, spec backr.RestoreTestSpec, archive string, scratchDir string, logs io.Writer) error {
+	env := append(os.Environ(),
+		"BACKR_ARCHIVE="+archive,
+		"BACKR_SCRATCH_DIR="+scratchDir,
+		"BACKR_PROJECT="+project.Name,
+	)
+
+	if len(spec.Cleanup) > 0 {
+		defer func() {
+			// the drill may have been cancelled, but the cleanup is still needed
+			if err := runCommand(context.Background(), spec.Cleanup, scratchDir, env, logs); err != nil {
+				fmt.Fprintf(logs, "cleanup failed: %v\n", err)
+			}
+		}()
+	}
+
+	if err := runCommand(ctx, spec.Command, scratchDir, env, logs); err != nil {
+		return fmt.Errorf("restore failed: %w", err)
+	}
+
+	for _, assertion := range spec.Assertions {
+		if err := runCommand(ctx, assertion, scratchDir, env, logs); err != nil {
+			return fmt.Errorf("assertion '%s' failed: %w", strings.Join(assertion, " "), err)
+		}
+	}
+
+	return nil
+}
+
+func runCommand(ctx context.Context, command []string, dir string, env []string, logs io.Writer) error {
+	fmt.Fprintf(logs, "$ %s\n", strings.Join(command, " "))
+
+	cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+	cmd.Dir = dir
+	cmd.Env = env
+	cmd.Stdout = logs
+	cmd.Stderr = logs
+
+	return cmd.Run()
+}
@@ -1,6 +1,8 @@
 package archive
 
 import (
+	"context"
+	"io"
 	"os"
 	"os/exec"
 )
@@ -16,24 +18,30 @@ func (s Stdout) GetOutputFileExtension() string {
 	return s.OutputFileExtension
 }
 
+// GetCommand implements Executor interface (stdout is redirected to the output file)
+func (s Stdout) GetCommand(output string) []string {
+	return s.Command
+}
+
 // Execute implements Executor interface
-func (s Stdout) Execute(workingDir string, output string) error {
+func (s Stdout) Execute(ctx context.Context, workingDir string, output string, logs io.Writer) error {
 
 	var cmd *exec.Cmd
 	if len(s.Command) > 1 {
-		cmd = exec.Command(s.Command[0], s.Command[1:]...)
+		cmd = exec.CommandContext(ctx, s.Command[0], s.Command[1:]...)
 	} else {
-		cmd = exec.Command(s.Command[0])
+		cmd = exec.CommandContext(ctx, s.Command[0])
 	}
 
 	outputFile, err := os.Create(output)
 	if err != nil {
 		return err
 	}
+	defer outputFile.Close()
 
 	cmd.Dir = workingDir
 	cmd.Stdout = outputFile
-	cmd.Stderr = os.Stderr
+	cmd.Stderr = logs
 
 	return cmd.Run()
 }
@@ -0,0 +1,32 @@
+package backr
+
+// APIScope represents a permission granted to a private API token
+type APIScope string
+
+const (
+	// ScopeTrigger allows to start and cancel backups
+	ScopeTrigger APIScope = "trigger"
+	// ScopeStatus allows to read the status of projects and jobs
+	ScopeStatus APIScope = "status"
+	// ScopeRestore allows to obtain URLs to download archives
+	ScopeRestore APIScope = "restore"
+)
+
+// AllScopes lists every scope, granted to the token generated at startup
+var AllScopes = []APIScope{ScopeTrigger, ScopeStatus, ScopeRestore}
+
+// APIToken represents a bearer token accepted by the private API
+type APIToken struct {
+	Token  string     `yaml:"token"`
+	Scopes []APIScope `yaml:"scopes"`
+}
+
+// HasScope returns true if the token grants the scope
+func (t APIToken) HasScope(scope APIScope) bool {
+	for _, s := range t.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
@@ -8,10 +8,33 @@ type BackupExecution interface {
 
 // Project represents a backup project executed by backr
 type Project struct {
-	Name     string
-	Backups  []Backup
-	Dir      string
-	Archiver Archiver
+	Name      string
+	Backups   []Backup
+	Dir       string
+	Archiver  Archiver
+	Timezone  string
+	Window    *BackupWindow
+	Retention *RetentionPolicy
+	// UploadRateLimit overrides the daemon upload bandwidth limit (see ParseRateLimit)
+	UploadRateLimit string
+	// ArchiveNameTemplate overrides the daemon template naming the archives (see GetArchiveNameTemplate)
+	ArchiveNameTemplate string
+	// S3 overrides the daemon options of the objects storing the archives
+	S3 *S3ObjectSettings
+	// RestoreTest periodically restores the latest archive, LastRestoreTest is the result of the last drill
+	RestoreTest     *RestoreTestSpec
+	LastRestoreTest *RestoreTestResult
+	// SizeCheck detects the abnormal archive sizes (see GetSizeCheck)
+	SizeCheck *SizeCheckSpec
+	// Paused suspends the scheduled backups, until PausedUntil if it is set
+	Paused      bool
+	PausedUntil time.Time
+	// SkipNext skips the next scheduled backup, as if it has been executed
+	SkipNext bool
+	// Conflicts lists the backup.yml files declaring the name of the project: it is not scheduled until only one of them remains
+	Conflicts []string
+	// Runs is the history of the last executions
+	Runs []Run
 }
 
 // Backup represents the state of a backup
@@ -48,6 +71,15 @@ func (p *Project) Update(spec ProjectBackupSpec) UpdateReport {
 		p.Archiver = Archiver{Type: "pliz"}
 	}
 
+	p.Timezone = spec.Timezone
+	p.Window = spec.Window
+	p.Retention = spec.Retention
+	p.UploadRateLimit = spec.UploadRateLimit
+	p.ArchiveNameTemplate = spec.ArchiveNameTemplate
+	p.S3 = spec.S3
+	p.RestoreTest = spec.RestoreTest
+	p.SizeCheck = spec.SizeCheck
+
 	report := UpdateReport{}
 
 	// this value will be decremented for each backup found
@@ -68,6 +100,8 @@ func (p *Project) Update(spec ProjectBackupSpec) UpdateReport {
 		// search if the item already exists
 		if existingBackup, ok := backupsByChecksum[checksum]; ok {
 			backup = existingBackup
+			// the TTL does not change the schedule of the backup
+			backup.TTL = backupSpec.TTL
 
 			report.Unchanged++
 			report.Deleted--
@@ -90,20 +124,94 @@ func (p *Project) Update(spec ProjectBackupSpec) UpdateReport {
 	return report
 }
 
+// MaxTTL returns the longest TTL of the backups of the project, in days
+func (p Project) MaxTTL() int {
+	ttl := 0
+	for _, backup := range p.Backups {
+		if backup.TTL > ttl {
+			ttl = backup.TTL
+		}
+	}
+	return ttl
+}
+
+// IsPaused returns true if the scheduled backups of the project are suspended at the given time
+func (p Project) IsPaused(now time.Time) bool {
+	return p.Paused && (p.PausedUntil.IsZero() || now.Before(p.PausedUntil))
+}
+
+// Pause suspends the scheduled backups. A zero until pauses the project indefinitely.
+func (p *Project) Pause(until time.Time) {
+	p.Paused = true
+	p.PausedUntil = until
+}
+
+// Resume restores the scheduled backups
+func (p *Project) Resume() {
+	p.Paused = false
+	p.PausedUntil = time.Time{}
+}
+
+// TimeSpec returns the time spec applying to the project, using its time zone and window if they are configured
+func (p Project) TimeSpec(defaults BackupTimeSpec) BackupTimeSpec {
+	timeSpec := defaults
+
+	if p.Window != nil {
+		timeSpec.Window = p.Window
+	}
+
+	if p.Timezone != "" {
+		location, err := time.LoadLocation(p.Timezone)
+		// the time zone is validated when parsing the spec: keep the default one if it is not available anymore
+		if err == nil {
+			timeSpec.Location = location
+		}
+	}
+
+	return timeSpec
+}
+
+// ObjectSettings returns the options of the S3 objects storing the archives of the project
+func (p Project) ObjectSettings(defaults S3ObjectSettings) S3ObjectSettings {
+	if p.S3 == nil {
+		return defaults
+	}
+
+	return defaults.Merge(*p.S3)
+}
+
 // GetNextBackupTime returns the time representing the moment where the backup should be executed,
 // according to the last backup time
 func (backup *Backup) GetNextBackupTime(timeSpec BackupTimeSpec, startupTime time.Time) time.Time {
 	// returns the date only if it's the first backup or the min age has been reached
 	// force the execution at a the specified start hour, to avoid performing backup at unwanted time
 
-	next := backup.LastExecution.Add(time.Duration(backup.MinAge) * time.Duration(backup.PeriodUnit) * time.Minute)
+	location := timeSpec.GetLocation()
+	interval := time.Duration(backup.MinAge) * time.Duration(backup.PeriodUnit) * time.Minute
+
+	next := backup.LastExecution.In(location)
+	if interval > 0 && interval%(24*time.Hour) == 0 {
+		// keep the same wall clock time, even if a DST transition occurs in the meantime
+		next = next.AddDate(0, 0, int(interval/(24*time.Hour)))
+	} else {
+		next = next.Add(interval)
+	}
+
+	if !backup.IgnoreStartupTime && timeSpec.Window != nil {
+		// the backup can start at any time inside the window: if it is due outside, it waits for the next opening
+		if backup.LastExecution.IsZero() {
+			next = startupTime
+		}
+		return timeSpec.Window.NextStart(next, location)
+	}
 
 	if !backup.IgnoreStartupTime && (backup.LastExecution.IsZero() || next.Before(startupTime)) {
-		date := time.Date(startupTime.Year(), startupTime.Month(), startupTime.Day(), timeSpec.Hour, timeSpec.Minute, 0, 0, time.Local)
+		localStartup := startupTime.In(location)
+		date := time.Date(localStartup.Year(), localStartup.Month(), localStartup.Day(), timeSpec.Hour, timeSpec.Minute, 0, 0, location)
 
 		// if the next date is before than the current time, then pick the next day at the same hour
 		if date.Before(startupTime) {
-			date = date.AddDate(0, 0, 1)
+			date = time.Date(localStartup.Year(), localStartup.Month(), localStartup.Day()+1, timeSpec.Hour, timeSpec.Minute, 0, 0, location)
 		}
 
 		return date
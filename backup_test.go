@@ -0,0 +1,99 @@
+package backr
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGetNextBackupTimeAcrossDST(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	if err != nil {
+		t.Skipf("time zone database not available: %v", err)
+	}
+
+	date := func(month time.Month, day, hour, minute int) time.Time {
+		return time.Date(2026, month, day, hour, minute, 0, 0, paris)
+	}
+
+	// in 2026, Paris springs forward on March 29 (02:00 CET -> 03:00 CEST) and falls back on October 25 (03:00 CEST -> 02:00 CET)
+	tests := []struct {
+		name          string
+		backup        Backup
+		timeSpec      BackupTimeSpec
+		startupTime   time.Time
+		expected      time.Time
+		expectedDelay time.Duration // between the last execution and the next one, if set
+	}{
+		{
+			name:          "daily keeps the wall clock time on spring forward",
+			backup:        Backup{BackupSpec: BackupSpec{MinAge: 1, PeriodUnit: 24 * 60, IgnoreStartupTime: true}, LastExecution: date(time.March, 28, 22, 0)},
+			expected:      date(time.March, 29, 22, 0),
+			expectedDelay: 23 * time.Hour,
+		},
+		{
+			name:          "daily keeps the wall clock time on fall back",
+			backup:        Backup{BackupSpec: BackupSpec{MinAge: 1, PeriodUnit: 24 * 60, IgnoreStartupTime: true}, LastExecution: date(time.October, 24, 22, 0)},
+			expected:      date(time.October, 25, 22, 0),
+			expectedDelay: 25 * time.Hour,
+		},
+		{
+			name:          "weekly keeps the wall clock time on spring forward",
+			backup:        Backup{BackupSpec: BackupSpec{MinAge: 7, PeriodUnit: 24 * 60, IgnoreStartupTime: true}, LastExecution: date(time.March, 25, 3, 0)},
+			expected:      date(time.April, 1, 3, 0),
+			expectedDelay: 7*24*time.Hour - time.Hour,
+		},
+		{
+			name:          "hourly keeps the elapsed time on spring forward",
+			backup:        Backup{BackupSpec: BackupSpec{MinAge: 6, PeriodUnit: 60, IgnoreStartupTime: true}, LastExecution: date(time.March, 29, 0, 30)},
+			expected:      date(time.March, 29, 7, 30),
+			expectedDelay: 6 * time.Hour,
+		},
+		{
+			name:          "hourly keeps the elapsed time on fall back",
+			backup:        Backup{BackupSpec: BackupSpec{MinAge: 6, PeriodUnit: 60, IgnoreStartupTime: true}, LastExecution: date(time.October, 25, 0, 30)},
+			expected:      date(time.October, 25, 5, 30),
+			expectedDelay: 6 * time.Hour,
+		},
+		{
+			name:        "first backup at the start hour of the spring forward day",
+			backup:      Backup{BackupSpec: BackupSpec{MinAge: 1, PeriodUnit: 24 * 60}},
+			timeSpec:    BackupTimeSpec{Hour: 4, Minute: 0, Location: paris},
+			startupTime: date(time.March, 29, 1, 0),
+			expected:    date(time.March, 29, 4, 0),
+		},
+		{
+			name:        "first backup at a start hour skipped by the spring forward",
+			backup:      Backup{BackupSpec: BackupSpec{MinAge: 1, PeriodUnit: 24 * 60}},
+			timeSpec:    BackupTimeSpec{Hour: 2, Minute: 30, Location: paris},
+			startupTime: date(time.March, 29, 1, 0),
+			expected:    date(time.March, 29, 3, 30),
+		},
+		{
+			name:        "first backup at the start hour of the fall back day",
+			backup:      Backup{BackupSpec: BackupSpec{MinAge: 1, PeriodUnit: 24 * 60}},
+			timeSpec:    BackupTimeSpec{Hour: 4, Minute: 0, Location: paris},
+			startupTime: date(time.October, 25, 1, 0),
+			expected:    date(time.October, 25, 4, 0),
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			if test.timeSpec.Location == nil {
+				test.timeSpec.Location = paris
+			}
+
+			next := test.backup.GetNextBackupTime(test.timeSpec, test.startupTime)
+			if !next.Equal(test.expected) {
+				t.Errorf("expected %v, got %v", test.expected, next.In(paris))
+			}
+
+			if test.expectedDelay != 0 {
+				if delay := next.Sub(test.backup.LastExecution); delay != test.expectedDelay {
+					t.Errorf("expected a delay of %v, got %v", test.expectedDelay, delay)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,130 @@
+package bolt
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+	"webup/backr"
+	"webup/backr/randstr"
+
+	"github.com/boltdb/bolt"
+)
+
+// leasesBucket stores the leases, next to the bucket of the projects
+var leasesBucket = []byte("leases")
+
+// Acquire takes the lease of name for ttl. If another valid lease exists, it is returned with ErrLeaseHeld (Locker interface)
+func (b *Storage) Acquire(ctx context.Context, name string, holder string, ttl time.Duration) (backr.Lease, error) {
+	now := time.Now()
+	lease := backr.Lease{
+		Name:       name,
+		Holder:     holder,
+		Token:      randstr.SecureRandomAlphaString(16),
+		AcquiredAt: now,
+		ExpiresAt:  now.Add(ttl),
+	}
+
+	var held backr.Lease
+	err := db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(leasesBucket)
+		if err != nil {
+			return err
+		}
+
+		if current, ok := getLease(bucket, name); ok && current.IsValid(now) {
+			held = current
+			return backr.ErrLeaseHeld
+		}
+
+		return putLease(bucket, lease)
+	})
+	if err != nil {
+		return held, err
+	}
+
+	log.WithField("lease", name).Debugln("Lease acquired.")
+
+	return lease, nil
+}
+
+// Renew extends a lease for ttl, returning ErrLeaseLost if it is not owned anymore (Locker interface)
+func (b *Storage) Renew(ctx context.Context, lease backr.Lease, ttl time.Duration) (backr.Lease, error) {
+	err := db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(leasesBucket)
+		if err != nil {
+			return err
+		}
+
+		// an expired lease is still owned, as long as nobody else acquired it
+		if current, ok := getLease(bucket, lease.Name); !ok || current.Token != lease.Token {
+			return backr.ErrLeaseLost
+		}
+
+		lease.ExpiresAt = time.Now().Add(ttl)
+		return putLease(bucket, lease)
+	})
+
+	return lease, err
+}
+
+// Release gives up a lease, if it is still owned (Locker interface)
+func (b *Storage) Release(ctx context.Context, lease backr.Lease) error {
+	return db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(leasesBucket)
+		if bucket == nil {
+			return nil
+		}
+
+		if current, ok := getLease(bucket, lease.Name); !ok || current.Token != lease.Token {
+			return nil
+		}
+
+		log.WithField("lease", lease.Name).Debugln("Lease released.")
+		return bucket.Delete([]byte(lease.Name))
+	})
+}
+
+// Leases returns the valid leases, by name (Locker interface)
+func (b *Storage) Leases(ctx context.Context) (map[string]backr.Lease, error) {
+	now := time.Now()
+	leases := map[string]backr.Lease{}
+
+	err := db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(leasesBucket)
+		if bucket == nil {
+			return nil
+		}
+
+		return bucket.ForEach(func(key, value []byte) error {
+			lease := backr.Lease{}
+			if err := json.Unmarshal(value, &lease); err != nil {
+				return err
+			}
+			if lease.IsValid(now) {
+				leases[string(key)] = lease
+			}
+			return nil
+		})
+	})
+
+	return leases, err
+}
+
+func getLease(bucket *bolt.Bucket, name string) (backr.Lease, bool) {
+	value := bucket.Get([]byte(name))
+	if value == nil {
+		return backr.Lease{}, false
+	}
+
+	lease := backr.Lease{}
+	if err := json.Unmarshal(value, &lease); err != nil {
+		return backr.Lease{}, false
+	}
+
+	return lease, true
+}
+
+func putLease(bucket *bolt.Bucket, lease backr.Lease) error {
+	jsonData, _ := json.Marshal(lease)
+	return bucket.Put([]byte(lease.Name), jsonData)
+}
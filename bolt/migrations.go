@@ -0,0 +1,146 @@
+package bolt
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+	"webup/backr"
+
+	"github.com/boltdb/bolt"
+)
+
+// metaBucket stores the metadata of the state, like the version of its schema
+var metaBucket = []byte("meta")
+
+var schemaVersionKey = []byte("schema_version")
+
+// migration upgrades the records of a schema version to the next one.
+// projects is the name of the bucket storing the projects.
+type migration struct {
+	description string
+	apply       func(tx *bolt.Tx, projects []byte) error
+}
+
+// migrations are applied in order: the schema version is the number of migrations applied.
+// Append a migration for each incompatible change of the stored records, never reorder nor remove them.
+var migrations = []migration{
+	{
+		description: "check the projects stored before the schema was versioned",
+		apply:       reencodeProjects,
+	},
+}
+
+// migrate upgrades the schema of the database to the current version, in a single transaction.
+// The database is copied before its records are migrated, next to it, with the previous version and the time as suffix.
+func migrate(db *bolt.DB, path string, projects []byte) error {
+	version := 0
+	empty := true
+
+	err := db.View(func(tx *bolt.Tx) error {
+		tx.ForEach(func(name []byte, _ *bolt.Bucket) error {
+			empty = false
+			return nil
+		})
+
+		var err error
+		version, err = schemaVersion(tx)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if version > len(migrations) {
+		return fmt.Errorf("The state was written by a newer version of backr (schema version %d, this version supports up to %d)", version, len(migrations))
+	}
+	if version == len(migrations) {
+		return nil
+	}
+
+	if !empty {
+		backupPath := fmt.Sprintf("%s.v%d-%s.bak", path, version, time.Now().Format("20060102T150405"))
+		log.WithField("file", backupPath).Infoln("Migrating the state: saving a copy first")
+
+		err := db.View(func(tx *bolt.Tx) error {
+			return tx.CopyFile(backupPath, 0600)
+		})
+		if err != nil {
+			return fmt.Errorf("Unable to save a copy of the state before migrating it: %v", err)
+		}
+	}
+
+	return db.Update(func(tx *bolt.Tx) error {
+		// a new state has nothing to migrate
+		for i := version; i < len(migrations) && !empty; i++ {
+			log.WithField("version", i+1).Infoln("Migrating the state:", migrations[i].description)
+
+			if err := migrations[i].apply(tx, projects); err != nil {
+				return fmt.Errorf("Unable to migrate the state to schema version %d: %v", i+1, err)
+			}
+		}
+
+		meta, err := tx.CreateBucketIfNotExists(metaBucket)
+		if err != nil {
+			return err
+		}
+
+		return meta.Put(schemaVersionKey, []byte(strconv.Itoa(len(migrations))))
+	})
+}
+
+// schemaVersion returns the version of the schema of the database, 0 if it is not versioned
+func schemaVersion(tx *bolt.Tx) (int, error) {
+	meta := tx.Bucket(metaBucket)
+	if meta == nil {
+		return 0, nil
+	}
+
+	value := meta.Get(schemaVersionKey)
+	if value == nil {
+		return 0, nil
+	}
+
+	version, err := strconv.Atoi(string(value))
+	if err != nil {
+		return 0, fmt.Errorf("The schema version of the state is not valid: %v", err)
+	}
+
+	return version, nil
+}
+
+// reencodeProjects ensures that each project can be decoded, and stores it again with the current encoding
+func reencodeProjects(tx *bolt.Tx, projects []byte) error {
+	bucket := tx.Bucket(projects)
+	if bucket == nil {
+		return nil
+	}
+
+	encoded := map[string][]byte{}
+	err := bucket.ForEach(func(key, value []byte) error {
+		project, err := backr.ProjectFromJSON(string(value))
+		if err != nil {
+			return fmt.Errorf("Unable to decode the project '%s': %v", key, err)
+		}
+
+		jsonData, err := json.Marshal(project)
+		if err != nil {
+			return err
+		}
+
+		encoded[string(key)] = jsonData
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// the bucket must not be modified while iterating over it
+	for key, jsonData := range encoded {
+		if err := bucket.Put([]byte(key), jsonData); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,169 @@
+package bolt
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+	"webup/backr"
+
+	"github.com/boltdb/bolt"
+)
+
+var projectsBucket = []byte("backups")
+
+// openState opens a new database and writes the given projects and schema version (none if negative) into it
+func openState(t *testing.T, version int, projects map[string]string) (*bolt.DB, string) {
+	path := filepath.Join(t.TempDir(), "state.db")
+	db, err := bolt.Open(path, 0644, &bolt.Options{Timeout: 1 * time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(projectsBucket)
+		if err != nil {
+			return err
+		}
+		for name, value := range projects {
+			if err := bucket.Put([]byte(name), []byte(value)); err != nil {
+				return err
+			}
+		}
+
+		if version < 0 {
+			return nil
+		}
+		meta, err := tx.CreateBucketIfNotExists(metaBucket)
+		if err != nil {
+			return err
+		}
+		return meta.Put(schemaVersionKey, []byte(strconv.Itoa(version)))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return db, path
+}
+
+func TestMigratePreviousVersion(t *testing.T) {
+	// the state written before the schema was versioned has no version
+	db, path := openState(t, -1, map[string]string{
+		"project": `{ "name": "project",  "dir": "/srv/project" }`,
+	})
+
+	if err := migrate(db, path, projectsBucket); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+
+	var version int
+	var stored []byte
+	err := db.View(func(tx *bolt.Tx) error {
+		var err error
+		version, err = schemaVersion(tx)
+		stored = append(stored, tx.Bucket(projectsBucket).Get([]byte("project"))...)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if version != len(migrations) {
+		t.Errorf("expected schema version %d, got %d", len(migrations), version)
+	}
+
+	expected, err := json.Marshal(backr.Project{Name: "project", Dir: "/srv/project"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(stored) != string(expected) {
+		t.Errorf("expected the project to be re-encoded as %s, got %s", expected, stored)
+	}
+
+	backups, err := filepath.Glob(path + ".v0-*.bak")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != 1 {
+		t.Fatalf("expected a copy of the state before its migration, got %v", backups)
+	}
+
+	// the copy is the state before the migration
+	copied, err := bolt.Open(backups[0], 0600, &bolt.Options{Timeout: 1 * time.Second, ReadOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer copied.Close()
+
+	err = copied.View(func(tx *bolt.Tx) error {
+		if tx.Bucket(metaBucket) != nil {
+			t.Error("expected the copy to have no schema version")
+		}
+		if value := tx.Bucket(projectsBucket).Get([]byte("project")); value == nil {
+			t.Error("expected the copy to keep the project")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMigrateCurrentVersion(t *testing.T) {
+	db, path := openState(t, len(migrations), map[string]string{
+		"project": `{"name":"project"}`,
+	})
+
+	if err := migrate(db, path, projectsBucket); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+
+	if backups, _ := filepath.Glob(path + ".v*.bak"); len(backups) != 0 {
+		t.Errorf("expected no copy of an up to date state, got %v", backups)
+	}
+}
+
+func TestMigrateNewerVersion(t *testing.T) {
+	db, path := openState(t, len(migrations)+1, map[string]string{
+		"project": `{"name":"project"}`,
+	})
+
+	err := migrate(db, path, projectsBucket)
+	if err == nil || !strings.Contains(err.Error(), "newer version") {
+		t.Fatalf("expected a newer schema version to be refused, got %v", err)
+	}
+
+	if backups, _ := filepath.Glob(path + ".v*.bak"); len(backups) != 0 {
+		t.Errorf("expected no copy of a refused state, got %v", backups)
+	}
+}
+
+func TestMigrateUndecodableProject(t *testing.T) {
+	db, path := openState(t, -1, map[string]string{
+		"project": `{"name":"project"}`,
+		"broken":  `{"name":`,
+	})
+
+	err := migrate(db, path, projectsBucket)
+	if err == nil || !strings.Contains(err.Error(), "'broken'") {
+		t.Fatalf("expected the undecodable project to fail the migration, got %v", err)
+	}
+
+	// the failed migration does not change the version
+	var version int
+	err = db.View(func(tx *bolt.Tx) error {
+		var err error
+		version, err = schemaVersion(tx)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != 0 {
+		t.Errorf("expected the schema version to stay 0, got %d", version)
+	}
+}
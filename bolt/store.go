@@ -5,15 +5,17 @@ import (
 	"fmt"
 	"time"
 	"webup/backr"
+	"webup/backr/logging"
 
 	"context"
 
 	"path/filepath"
 
 	"github.com/boltdb/bolt"
-	log "github.com/sirupsen/logrus"
 )
 
+var log = logging.Logger(logging.Bolt)
+
 // Storage implements the StateStorage interface to store the state locally, using BoltDB
 type Storage struct {
 	bucket []byte
@@ -24,10 +26,19 @@ var db *bolt.DB
 func GetStorage(opts backr.Settings) (backr.StateStorer, error) {
 	if db == nil {
 		log.Debugln("Opening BoltDB...")
-		newConnection, err := bolt.Open(filepath.Join(*opts.StateStorage.LocalPath, "state.db"), 0644, &bolt.Options{Timeout: 1 * time.Second})
+		path := filepath.Join(*opts.StateStorage.LocalPath, "state.db")
+		newConnection, err := bolt.Open(path, 0644, &bolt.Options{Timeout: 1 * time.Second})
+		if err == bolt.ErrTimeout {
+			return nil, fmt.Errorf("%s is locked by another process, like a running daemon", path)
+		}
 		if err != nil {
 			return nil, err
 		}
+
+		if err := migrate(newConnection, path, []byte(opts.BackupRootDir)); err != nil {
+			newConnection.Close()
+			return nil, err
+		}
 		db = newConnection
 		log.Debugln("BoltDB opened.")
 	}
@@ -65,7 +76,10 @@ func (b *Storage) ConfiguredProjects(ctx context.Context) (map[string]backr.Proj
 		c := bucket.Cursor()
 
 		for key, value := c.First(); key != nil; key, value = c.Next() {
-			project := backr.ProjectFromJSON(string(value))
+			project, err := backr.ProjectFromJSON(string(value))
+			if err != nil {
+				return fmt.Errorf("Unable to decode the project '%s': %v", key, err)
+			}
 
 			projects[string(key)] = project
 		}
@@ -79,40 +93,88 @@ func (b *Storage) ConfiguredProjects(ctx context.Context) (map[string]backr.Proj
 // SaveProject store a project (Storer interface)
 func (b *Storage) SaveProject(ctx context.Context, project backr.Project) error {
 
-	log.Debugln("Saving a project into BoltDB...")
+	logEntry := log.WithField("project", project.Name)
+	logEntry.Debugln("Saving a project into BoltDB...")
 
 	err := db.Update(func(tx *bolt.Tx) error {
 		bucket, err := tx.CreateBucketIfNotExists(b.bucket)
 		if err != nil {
-			log.Debugln("Unable to get or create the bucket into BoltDB.", err)
+			logEntry.Debugln("Unable to get or create the bucket into BoltDB.", err)
 			return err
 		}
 
 		// get json data
-		jsonData, _ := json.Marshal(project)
+		jsonData, err := json.Marshal(project)
+		if err != nil {
+			return err
+		}
 
 		err = bucket.Put([]byte(project.Name), jsonData)
 		if err != nil {
-			log.Debugln("Unable to save the project into BoltDB.", err)
+			logEntry.Debugln("Unable to save the project into BoltDB.", err)
 			return err
 		}
-		log.Debugln("Save ok.")
+		logEntry.Debugln("Save ok.")
 		return nil
 	})
 
 	return err
 }
 
+// UpdateProject applies update to a stored project, in a single transaction: BoltDB serializes them (Storer interface)
+func (b *Storage) UpdateProject(ctx context.Context, name string, update func(project *backr.Project)) (*backr.Project, error) {
+
+	log.WithField("project", name).Debugln("Updating a project into BoltDB...")
+
+	var project *backr.Project
+
+	err := db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(b.bucket)
+		if bucket == nil {
+			// no project configured: nothing to update
+			return nil
+		}
+
+		value := bucket.Get([]byte(name))
+		if len(value) == 0 {
+			return nil
+		}
+
+		p, err := backr.ProjectFromJSON(string(value))
+		if err != nil {
+			return fmt.Errorf("Unable to decode the project '%s': %v", name, err)
+		}
+
+		update(&p)
+
+		jsonData, err := json.Marshal(p)
+		if err != nil {
+			return err
+		}
+		if err := bucket.Put([]byte(name), jsonData); err != nil {
+			return err
+		}
+
+		project = &p
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return project, nil
+}
+
 // DeleteProject removes a project (Storer interface)
 func (b *Storage) DeleteProject(ctx context.Context, project backr.Project) error {
 
-	log.Debugln("Deleting a project from BoltDB...")
+	log.WithField("project", project.Name).Debugln("Deleting a project from BoltDB...")
 
 	err := db.Update(func(tx *bolt.Tx) error {
 		bucket := tx.Bucket(b.bucket)
 		if bucket == nil {
-			log.Debugln("Unable to get or create the bucket into BoltDB.")
-			return fmt.Errorf("Bucket not found")
+			// no project configured: nothing to delete
+			return nil
 		}
 
 		err := bucket.Delete([]byte(project.Name))
@@ -144,7 +206,10 @@ func (b *Storage) GetProject(ctx context.Context, name string) (*backr.Project,
 			return nil
 		}
 
-		p := backr.ProjectFromJSON(jsonData)
+		p, err := backr.ProjectFromJSON(jsonData)
+		if err != nil {
+			return fmt.Errorf("Unable to decode the project '%s': %v", name, err)
+		}
 		project = &p
 
 		return nil
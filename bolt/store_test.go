@@ -0,0 +1,21 @@
+package bolt
+
+import (
+	"testing"
+	"webup/backr"
+	"webup/backr/statetest"
+)
+
+func TestStorage(t *testing.T) {
+	statetest.Run(t, func(t *testing.T) backr.StateStorer {
+		dir := t.TempDir()
+		storer, err := GetStorage(backr.Settings{
+			BackupRootDir: "backups",
+			StateStorage:  backr.StateStorageSettings{LocalPath: &dir},
+		})
+		if err != nil {
+			t.Fatalf("GetStorage: %v", err)
+		}
+		return storer
+	})
+}
@@ -2,9 +2,16 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
+	"net/http"
 	"os"
 	"os/signal"
+	"path"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
 	"webup/backr"
 	"webup/backr/privatehttp"
@@ -19,85 +26,82 @@ import (
 func main() {
 	app := cli.App("backr", "Perform backups")
 
-	app.Version("v version", "Backr 5 (build 10)")
+	app.Version("v version", "Backr "+backr.Version)
 
 	log.SetFormatter(&log.TextFormatter{FullTimestamp: true})
 
 	app.Command("daemon", "Start the backup process", func(cmd *cli.Cmd) {
 
 		// cmd.Spec = "-w... --etcd|--local [--time] [--config-refresh-rate]"
-		cmd.Spec = "-w... --etcd|--local [--time] [--secret-file-path] [--api-listen] [--debug]"
+		cmd.Spec = settingsSpec + daemonSpec
 
-		// state storage
-		stateStorageSettings := getStateStorateSettings(cmd)
+		getSettings := settingsOpts(cmd, true)
 
-		// S3
-		s3Settings := getS3Settings(cmd)
-		if s3Settings == nil {
-			log.Warnln("S3 upload will be unavailable because some args or env vars are missing to configure S3 upload")
-		}
+		cmd.Action = func() {
 
-		// options
-		watchDirs := cmd.StringsOpt("w watch", []string{}, "Specifies the directories to watch for finding backup.yml files")
-		timeOpt := cmd.StringOpt("time", "01:00", "Specifies the moment when the backup process will be started")
-		secretFilePath := cmd.StringOpt("secret-file-path", "~/.backr/jwt_secret", "Path to the file storing the secret used for generating access token to backup files")
-		apiListenOpt := cmd.StringOpt("api-listen", ":22257", "Configure IP and port for HTTP API")
-		debug := cmd.BoolOpt("debug", false, "Enables the debug logs output")
+			root, cancel := context.WithCancel(context.Background())
 
-		cmd.Action = func() {
+			// prepare options
+			currentSettings, logSetup, err := getSettings()
+			if err != nil {
+				log.Errorln(err)
+				cli.Exit(1)
+			}
+			logSetup.apply()
 
-			// set debug log level if needed
-			if *debug {
-				log.SetLevel(log.DebugLevel)
+			if currentSettings.DryRun {
+				log.Warnln("Dry run: backups will not be executed and the state will not be updated")
 			}
 
-			ctx, cancel := context.WithCancel(context.Background())
+			// closed when the daemon is stopping: the running backups are completed, but no other one is started
+			stopping := make(chan struct{})
 
-			// prepare options
-			currentSettings := backr.NewDefaultSettings()
-			currentSettings.StateStorage = stateStorageSettings
-			currentSettings.WatchDirs = *watchDirs
-			currentSettings.S3 = s3Settings
-			currentSettings.ApiListen = *apiListenOpt
-
-			path, _ := homedir.Expand(*secretFilePath)
-			currentSettings.SecretFilepath = path
-
-			// parse the time option
-			if timeOpt != nil {
-				parsedTime, err := time.Parse("15:04", *timeOpt)
-				if err == nil {
-					currentSettings.TimeSpec.Hour = parsedTime.Hour()
-					currentSettings.TimeSpec.Minute = parsedTime.Minute()
-				} else {
-					log.Warnf("Time option is not correctly formatted, must be like '00:00'. Default option will be used instead")
-				}
-			}
+			ctx, setSettings := backr.NewContextWithReloadableSettings(backr.NewContextWithShutdown(root, stopping), currentSettings)
+
+			// the projects locking their archives are only known once their specs are read
+			tasks.UpdateStateFromSpec(ctx)
 
-			ctx = backr.NewContextWithSettings(ctx, currentSettings)
+			if err := tasks.CheckObjectLock(ctx); err != nil {
+				log.Errorln(err)
+				cli.Exit(1)
+			}
 
-			// handle the SIGINT signal
+			// handle the SIGINT and SIGTERM signals
 			waiting := make(chan os.Signal, 1)
-			signal.Notify(waiting, os.Interrupt, os.Kill)
+			signal.Notify(waiting, os.Interrupt, syscall.SIGTERM)
+
+			// handle the SIGHUP signal
+			reload := make(chan os.Signal, 1)
+			signal.Notify(reload, syscall.SIGHUP)
 
 			// prepare ticker
 			ticker := time.NewTicker(5 * time.Minute)
 
+			// closed when the backup routine is stopped
+			backupsDone := make(chan struct{})
+
 			go func() {
+				defer close(backupsDone)
 				isRunning := false
 
 				for {
 					select {
+					case <-stopping:
+						return
 					case <-ticker.C:
 						log.Debugln("Tick received")
 
 						if !isRunning {
 							isRunning = true
 
+							// the settings reloaded during the backups only apply to the next ones
+							settings, _ := backr.SettingsFromContext(ctx)
+							tickCtx := backr.NewContextWithSettings(ctx, settings)
+
 							// execute the update of state from specs (yml files)
-							tasks.UpdateStateFromSpec(ctx)
+							tasks.UpdateStateFromSpec(tickCtx)
 							// execute the backup routine
-							tasks.PerformBackup(ctx)
+							tasks.PerformBackup(tickCtx)
 
 							isRunning = false
 						} else {
@@ -107,114 +111,648 @@ func main() {
 				}
 			}()
 
+			go func() {
+				for range reload {
+					current, _ := backr.SettingsFromContext(ctx)
+					if settings, ok := reloadSettings(getSettings, current); ok {
+						setSettings(settings)
+						log.Infoln("Configuration reloaded")
+					}
+				}
+			}()
+
 			// start HTTP API daemons
-			startPrivateAPI(ctx)
+			api := privatehttp.NewAPI()
+			startPrivateAPI(ctx, api)
 
 			// waiting for signal
 			<-waiting
-			// stop the ticker
+
+			// stop the ticker and refuse the new backups
 			ticker.Stop()
-			// cancelling ctx
+			close(stopping)
+
+			settings, _ := backr.SettingsFromContext(ctx)
+			log.WithField("grace_period", settings.ShutdownGracePeriod).Infoln("Stopping: waiting for the running backups...")
+
+			shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), settings.ShutdownGracePeriod)
+			defer cancelShutdown()
+
+			// a second signal stops without waiting
+			go func() {
+				select {
+				case <-waiting:
+					log.Warnln("Signal received again: cancelling the running backups")
+					cancelShutdown()
+				case <-shutdownCtx.Done():
+				}
+			}()
+
+			apiDone := make(chan struct{})
+			go func() {
+				defer close(apiDone)
+				if err := api.Shutdown(shutdownCtx); err != nil {
+					log.WithField("err", err).Warnln("Private API jobs cancelled")
+				}
+			}()
+
+			for _, done := range []chan struct{}{backupsDone, apiDone} {
+				select {
+				case <-done:
+				case <-shutdownCtx.Done():
+				}
+			}
+			if shutdownCtx.Err() == context.DeadlineExceeded {
+				log.Warnln("Grace period expired: cancelling the running backups")
+			}
+
+			// cancel what is still running, and wait for the results to be saved before closing the state storage
 			cancel()
-			// cleanup current state storage
-			state.CleanupStorage(currentSettings)
+			<-backupsDone
+			<-apiDone
+
+			state.CleanupStorage(settings)
 
 			log.Infoln("Stopped.")
 		}
 	})
 
+	app.Command("run", "Update the state from backup.yml files and execute the needed backups once", func(cmd *cli.Cmd) {
+
+		cmd.Spec = settingsSpec
+
+		getSettings := settingsOpts(cmd, false)
+
+		cmd.Action = func() {
+			currentSettings, logSetup, err := getSettings()
+			if err != nil {
+				log.Errorln(err)
+				cli.Exit(1)
+			}
+			logSetup.apply()
+
+			ctx := backr.NewContextWithSettings(context.Background(), currentSettings)
+			defer state.CleanupStorage(currentSettings)
+
+			tasks.UpdateStateFromSpec(ctx)
+
+			if err := tasks.CheckObjectLock(ctx); err != nil {
+				log.Errorln(err)
+				cli.Exit(1)
+			}
+
+			if !currentSettings.DryRun {
+				if failed := tasks.PerformBackup(ctx); failed {
+					cli.Exit(1)
+				}
+				return
+			}
+
+			plans, err := tasks.PlanBackup(ctx)
+			if err != nil {
+				fmt.Printf("ERROR: %v\n", err)
+				cli.Exit(1)
+			}
+
+			if len(plans) == 0 {
+				fmt.Println("No backup needed.")
+			}
+
+			for _, plan := range plans {
+				fmt.Printf("%s (%s)\n", plan.Project, plan.Dir)
+				fmt.Printf("  archiver: %s\n", plan.Archiver)
+				fmt.Printf("   command: %s\n", strings.Join(plan.Command, " "))
+				if plan.Object != "" {
+					fmt.Printf("    object: s3://%s/%s\n", plan.Bucket, plan.Object)
+					if len(plan.Destinations) > 1 {
+						fmt.Printf("  replicas: %s\n", strings.Join(plan.Destinations[1:], ", "))
+					}
+				} else {
+					fmt.Println("    object: none (S3 not configured)")
+				}
+			}
+		}
+	})
+
 	app.Command("now", "Execute a backup immediately", func(cmd *cli.Cmd) {
 
-		cmd.Spec = "[--url] PROJECT_NAME"
+		cmd.Spec = "[--url] [--token-file] [--wait|--detach] PROJECT_NAME"
 
-		url := cmd.StringOpt("url", "http://127.0.0.1:22258", "URL of private API")
+		newClient := privateAPIClientOpts(cmd)
+		wait := cmd.BoolOpt("wait", true, "Wait for the end of the backup, displaying the archiver output (--wait=false is the same as --detach)")
+		detach := cmd.BoolOpt("detach", false, "Only start the backup and print the job ID")
 		projectName := cmd.StringArg("PROJECT_NAME", "", "A project name configured inside backr")
 
 		cmd.Action = func() {
-			client := privatehttp.NewClient(*url)
-			info, err := client.Backup(*projectName)
+			client := newClient()
+
+			job, err := client.StartBackup(*projectName)
 			if err != nil {
 				fmt.Printf("ERROR: %v\n", err)
+				cli.Exit(1)
 			}
 
-			fmt.Println("name:", info.Name)
-			fmt.Println("url:", info.URL)
+			if *detach || !*wait {
+				fmt.Println("job:", job.ID)
+				return
+			}
+
+			// the stream ends when the job is finished
+			err = client.StreamJobLogs(job.ID, os.Stderr)
+			if err != nil {
+				fmt.Printf("ERROR: unable to get the job output: %v\n", err)
+			}
+
+			job, err = client.GetJob(job.ID)
+			if err != nil {
+				fmt.Printf("ERROR: %v\n", err)
+				cli.Exit(1)
+			}
+
+			if !job.IsFinished() {
+				fmt.Printf("job %s is still %s\n", job.ID, job.State)
+				return
+			}
+
+			if job.State != backr.JobSucceeded {
+				fmt.Printf("ERROR: job %s %s: %s\n", job.ID, job.State, job.Error)
+				cli.Exit(1)
+			}
+
+			if job.Result != nil {
+				if job.Result.Name != "" {
+					fmt.Println("name:", job.Result.Name)
+					fmt.Println("url:", job.Result.URL)
+				}
+				fmt.Println("size:", backr.FormatSize(job.Result.Size))
+				if job.Result.SizeAnomaly != "" {
+					fmt.Println("WARNING:", job.Result.SizeAnomaly)
+				}
+			}
 		}
 
 	})
 
-	app.Run(os.Args)
-}
+	app.Command("pause", "Suspend the scheduled backups of a project", func(cmd *cli.Cmd) {
+
+		cmd.Spec = "[--url] [--token-file] [--until] PROJECT_NAME"
+
+		newClient := privateAPIClientOpts(cmd)
+		until := cmd.StringOpt("until", "", "Resume automatically at this time ('2006-01-02 15:04', '2006-01-02', RFC3339 or a duration like '12h' or '3d')")
+		projectName := cmd.StringArg("PROJECT_NAME", "", "A project name configured inside backr")
 
-func getS3Settings(cmd *cli.Cmd) *backr.S3Settings {
-	bucket := cmd.String(cli.StringOpt{
-		Name:   "s3-bucket",
-		Value:  "",
-		Desc:   "S3 bucket name",
-		EnvVar: "S3_BUCKET",
+		cmd.Action = func() {
+			var untilTime time.Time
+			if *until != "" {
+				parsed, err := parseUntil(*until, time.Now())
+				if err != nil {
+					fmt.Printf("ERROR: %v\n", err)
+					cli.Exit(1)
+				}
+				untilTime = parsed
+			}
+
+			err := newClient().PauseProject(*projectName, untilTime)
+			if err != nil {
+				fmt.Printf("ERROR: %v\n", err)
+				cli.Exit(1)
+			}
+
+			if untilTime.IsZero() {
+				fmt.Printf("%s paused\n", *projectName)
+			} else {
+				fmt.Printf("%s paused until %s\n", *projectName, untilTime.Format(time.RFC3339))
+			}
+		}
 	})
-	endpoint := cmd.String(cli.StringOpt{
-		Name:   "s3-endpoint",
-		Value:  "",
-		Desc:   "S3 API endpoint",
-		EnvVar: "S3_ENDPOINT",
+
+	app.Command("resume", "Restore the scheduled backups of a paused project", func(cmd *cli.Cmd) {
+
+		cmd.Spec = "[--url] [--token-file] PROJECT_NAME"
+
+		newClient := privateAPIClientOpts(cmd)
+		projectName := cmd.StringArg("PROJECT_NAME", "", "A project name configured inside backr")
+
+		cmd.Action = func() {
+			err := newClient().ResumeProject(*projectName)
+			if err != nil {
+				fmt.Printf("ERROR: %v\n", err)
+				cli.Exit(1)
+			}
+
+			fmt.Printf("%s resumed\n", *projectName)
+		}
 	})
-	accessKey := cmd.String(cli.StringOpt{
-		Name:   "s3-access-key",
-		Value:  "",
-		Desc:   "S3 Access Key",
-		EnvVar: "S3_ACCESS_KEY",
+
+	app.Command("skip-next", "Skip the next scheduled backup of a project", func(cmd *cli.Cmd) {
+
+		cmd.Spec = "[--url] [--token-file] PROJECT_NAME"
+
+		newClient := privateAPIClientOpts(cmd)
+		projectName := cmd.StringArg("PROJECT_NAME", "", "A project name configured inside backr")
+
+		cmd.Action = func() {
+			err := newClient().SkipNextBackup(*projectName)
+			if err != nil {
+				fmt.Printf("ERROR: %v\n", err)
+				cli.Exit(1)
+			}
+
+			fmt.Printf("next backup of %s will be skipped\n", *projectName)
+		}
 	})
-	secretKey := cmd.String(cli.StringOpt{
-		Name:   "s3-secret-key",
-		Value:  "",
-		Desc:   "S3 Secret Key",
-		EnvVar: "S3_SECRET_KEY",
+
+	app.Command("prune", "Delete the archives of a project not kept by its retention policy", func(cmd *cli.Cmd) {
+
+		cmd.Spec = "[--url] [--token-file] [--dry-run] PROJECT_NAME"
+
+		newClient := privateAPIClientOpts(cmd)
+		dryRun := cmd.BoolOpt("dry-run", false, "Only list the archives that would be kept or deleted")
+		projectName := cmd.StringArg("PROJECT_NAME", "", "A project name configured inside backr")
+
+		cmd.Action = func() {
+			decisions, err := newClient().Prune(*projectName, *dryRun)
+			if err != nil {
+				fmt.Printf("ERROR: %v\n", err)
+				cli.Exit(1)
+			}
+
+			for _, decision := range decisions {
+				action := "delete"
+				if decision.Keep {
+					action = "keep"
+				}
+				if decision.Deleted {
+					action = "deleted"
+				}
+
+				fmt.Printf("%-7s %s  %s\n", action, decision.Archive.Name, strings.Join(decision.Reasons, ", "))
+			}
+		}
 	})
-	useTLS := cmd.Bool(cli.BoolOpt{
-		Name:   "s3-use-tls",
-		Value:  true,
-		Desc:   "Use TLS to connect to S3 API",
-		EnvVar: "S3_USE_TLS",
+
+	app.Command("logs", "Display the archiver output of a backup execution", func(cmd *cli.Cmd) {
+
+		cmd.Spec = "[--url] [--token-file] [--run] PROJECT_NAME"
+
+		newClient := privateAPIClientOpts(cmd)
+		runID := cmd.IntOpt("run", 0, "ID of the run (defaults to the last one)")
+		projectName := cmd.StringArg("PROJECT_NAME", "", "A project name configured inside backr")
+
+		cmd.Action = func() {
+			run, err := newClient().GetRun(*projectName, *runID)
+			if err != nil {
+				fmt.Printf("ERROR: %v\n", err)
+				cli.Exit(1)
+			}
+
+			trigger := "scheduled"
+			if run.Manual {
+				trigger = "manual"
+			}
+			result := "OK"
+			if !run.Success {
+				result = "FAILED: " + run.Error
+			}
+
+			fmt.Printf("run #%d (%s) started at %s, took %v\n", run.ID, trigger, run.StartedAt.Format(time.RFC3339), run.FinishedAt.Sub(run.StartedAt).Round(time.Second))
+			fmt.Println(result)
+			if run.Archive != "" {
+				fmt.Println("archive:", run.Archive)
+			}
+			for _, destination := range run.Destinations {
+				if destination.Success {
+					fmt.Printf("  uploaded to %s\n", destination.Destination)
+				} else {
+					fmt.Printf("  not uploaded to %s: %s\n", destination.Destination, destination.Error)
+				}
+			}
+			fmt.Println()
+			fmt.Print(run.Output)
+		}
 	})
 
-	if *bucket != "" && *endpoint != "" && *accessKey != "" && *secretKey != "" {
-		return &backr.S3Settings{
-			Bucket:    *bucket,
-			Endpoint:  *endpoint,
-			AccessKey: *accessKey,
-			SecretKey: *secretKey,
-			UseTLS:    *useTLS,
+	app.Command("verify", "Check that the archive of a backup execution is available on each destination, and matches its manifest", func(cmd *cli.Cmd) {
+
+		cmd.Spec = "[--url] [--token-file] [--run] PROJECT_NAME"
+
+		newClient := privateAPIClientOpts(cmd)
+		runID := cmd.IntOpt("run", 0, "ID of the run (defaults to the last one)")
+		projectName := cmd.StringArg("PROJECT_NAME", "", "A project name configured inside backr")
+
+		cmd.Action = func() {
+			results, err := newClient().VerifyRun(*projectName, *runID)
+			if err != nil {
+				fmt.Printf("ERROR: %v\n", err)
+				cli.Exit(1)
+			}
+
+			missing := false
+			for _, result := range results {
+				switch {
+				case !result.Available:
+					fmt.Printf("%-10s MISSING  %s: %s\n", result.Destination, result.Archive, result.Error)
+					missing = true
+				case result.Error != "":
+					fmt.Printf("%-10s INVALID  %s: %s\n", result.Destination, result.Archive, result.Error)
+					missing = true
+				case result.Manifest == nil:
+					fmt.Printf("%-10s OK       %s (%d bytes, no manifest)\n", result.Destination, result.Archive, result.Size)
+				default:
+					fmt.Printf("%-10s OK       %s (%d bytes, created by %s at %s, sha256 %s)\n", result.Destination, result.Archive, result.Size,
+						result.Manifest.Host, result.Manifest.FinishedAt.Format(time.RFC3339), result.Manifest.SHA256)
+				}
+			}
+
+			if missing {
+				cli.Exit(1)
+			}
 		}
-	}
+	})
 
-	return nil
-}
+	app.Command("restore", "Download the archive of a backup execution from one of its destinations", func(cmd *cli.Cmd) {
+
+		cmd.Spec = "[--url] [--token-file] [--run] [--destination] [-o] PROJECT_NAME"
+
+		newClient := privateAPIClientOpts(cmd)
+		runID := cmd.IntOpt("run", 0, "ID of the run (defaults to the last one)")
+		destination := cmd.StringOpt("destination", "", "Name of the destination to download from (defaults to the first one having the archive)")
+		outputPath := cmd.StringOpt("o output", "", "File receiving the archive (defaults to the name of the archive in the current directory)")
+		projectName := cmd.StringArg("PROJECT_NAME", "", "A project name configured inside backr")
+
+		cmd.Action = func() {
+			location, err := newClient().GetArchiveLocation(*projectName, *runID, *destination)
+			if err != nil {
+				fmt.Printf("ERROR: %v\n", err)
+				cli.Exit(1)
+			}
+
+			if *outputPath == "" {
+				run, err := newClient().GetRun(*projectName, *runID)
+				if err != nil {
+					fmt.Printf("ERROR: %v\n", err)
+					cli.Exit(1)
+				}
+				*outputPath = path.Base(run.Archive)
+			}
+
+			if err := download(location.URL, *outputPath); err != nil {
+				fmt.Printf("ERROR: %v\n", err)
+				cli.Exit(1)
+			}
+
+			fmt.Printf("archive downloaded from %s into %s\n", location.Destination, *outputPath)
+
+			if location.Manifest == nil {
+				fmt.Println("the archive has no manifest, it can not be checked")
+				return
+			}
+
+			manifest := location.Manifest
+			if err := manifest.Verify(*outputPath); err != nil {
+				fmt.Printf("ERROR: %v\n", err)
+				cli.Exit(1)
+			}
+			fmt.Printf("archive checked (sha256 %s), created by %s (%s archiver) at %s\n", manifest.SHA256, manifest.Host, manifest.Archiver, manifest.FinishedAt.Format(time.RFC3339))
+		}
+	})
+
+	app.Command("restore-test", "Execute the restore drill of a project on its latest archive", func(cmd *cli.Cmd) {
+
+		cmd.Spec = "[--url] [--token-file] PROJECT_NAME"
+
+		newClient := privateAPIClientOpts(cmd)
+		projectName := cmd.StringArg("PROJECT_NAME", "", "A project name configured inside backr")
 
-func getStateStorateSettings(cmd *cli.Cmd) backr.StateStorageSettings {
-	etcdEndpoints := cmd.String(cli.StringOpt{
-		Name:   "etcd",
-		Value:  "http://localhost:2379",
-		Desc:   "Endpoints for etcd (separated by a comma)",
-		EnvVar: "ETCD_ADVERTISE_URLS",
+		cmd.Action = func() {
+			result, err := newClient().RunRestoreTest(*projectName)
+			if err != nil {
+				fmt.Printf("ERROR: %v\n", err)
+				cli.Exit(1)
+			}
+
+			fmt.Printf("restore test of %s (from %s), took %v\n", result.Archive, result.Destination, result.FinishedAt.Sub(result.StartedAt).Round(time.Second))
+			if result.Success {
+				fmt.Println("OK")
+			} else {
+				fmt.Println("FAILED: " + result.Error)
+			}
+			fmt.Println()
+			fmt.Print(result.Output)
+
+			if !result.Success {
+				cli.Exit(1)
+			}
+		}
 	})
 
-	localPath := cmd.String(cli.StringOpt{
-		Name:   "local",
-		Value:  "",
-		Desc:   "Local directory where the state will be stored (r/w permissions required)",
-		EnvVar: "STATE_STORAGE_LOCAL",
+	app.Command("state", "Inspect the state storage, move it to another one, or remove a project from it", func(cmd *cli.Cmd) {
+
+		cmd.Command("export", "Write all the projects of the state storage as JSON", func(cmd *cli.Cmd) {
+
+			cmd.Spec = stateStorageSpec + " [-o]"
+
+			getSettings := stateStorageOpts(cmd)
+			output := cmd.StringOpt("o output", "", "Write the export into this file instead of the standard output")
+
+			cmd.Action = func() {
+				currentSettings := getSettings()
+				ctx := backr.NewContextWithSettings(context.Background(), currentSettings)
+				defer state.CleanupStorage(currentSettings)
+
+				export, err := tasks.ExportState(ctx)
+				if err != nil {
+					fmt.Printf("ERROR: %v\n", err)
+					cli.Exit(1)
+				}
+
+				w := io.Writer(os.Stdout)
+				if *output != "" {
+					f, err := os.OpenFile(*output, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+					if err != nil {
+						fmt.Printf("ERROR: %v\n", err)
+						cli.Exit(1)
+					}
+					defer f.Close()
+					w = f
+				}
+
+				encoder := json.NewEncoder(w)
+				encoder.SetIndent("", "  ")
+				if err := encoder.Encode(export); err != nil {
+					fmt.Printf("ERROR: %v\n", err)
+					cli.Exit(1)
+				}
+
+				if *output != "" {
+					fmt.Printf("%d projects exported into %s\n", len(export.Projects), *output)
+				}
+			}
+		})
+
+		cmd.Command("import", "Store the projects of an export into the state storage", func(cmd *cli.Cmd) {
+
+			cmd.Spec = stateStorageSpec + " [--mode] FILE"
+
+			getSettings := stateStorageOpts(cmd)
+			mode := cmd.StringOpt("mode", string(backr.ImportMerge), "'merge' keeps the existing projects, 'overwrite' replaces them with the imported ones")
+			file := cmd.StringArg("FILE", "", "A file written by 'state export' ('-' for the standard input)")
+
+			cmd.Action = func() {
+				r := io.Reader(os.Stdin)
+				if *file != "-" {
+					f, err := os.Open(*file)
+					if err != nil {
+						fmt.Printf("ERROR: %v\n", err)
+						cli.Exit(1)
+					}
+					defer f.Close()
+					r = f
+				}
+
+				export := backr.StateExport{}
+				if err := json.NewDecoder(r).Decode(&export); err != nil {
+					fmt.Printf("ERROR: unable to decode the export: %v\n", err)
+					cli.Exit(1)
+				}
+
+				currentSettings := getSettings()
+				ctx := backr.NewContextWithSettings(context.Background(), currentSettings)
+				defer state.CleanupStorage(currentSettings)
+
+				report, err := tasks.ImportState(ctx, export, backr.ImportMode(*mode))
+				if err != nil {
+					fmt.Printf("ERROR: %v\n", err)
+					cli.Exit(1)
+				}
+
+				fmt.Printf("%d created, %d replaced, %d skipped\n", report.Created, report.Replaced, report.Skipped)
+			}
+		})
+
+		cmd.Command("forget", "Remove a project from the state storage, like a project renamed by --project-namespace. Its archives are left on the destinations", func(cmd *cli.Cmd) {
+
+			cmd.Spec = stateStorageSpec + " PROJECT_NAME"
+
+			getSettings := stateStorageOpts(cmd)
+			projectName := cmd.StringArg("PROJECT_NAME", "", "A project name configured inside backr")
+
+			cmd.Action = func() {
+				currentSettings := getSettings()
+				ctx := backr.NewContextWithSettings(context.Background(), currentSettings)
+				defer state.CleanupStorage(currentSettings)
+
+				if err := tasks.ForgetProject(ctx, *projectName); err != nil {
+					fmt.Printf("ERROR: %v\n", err)
+					cli.Exit(1)
+				}
+
+				fmt.Printf("%s removed from the state\n", *projectName)
+			}
+		})
+
+		cmd.Command("show", "Display a project as stored in the state storage", func(cmd *cli.Cmd) {
+
+			cmd.Spec = stateStorageSpec + " PROJECT_NAME"
+
+			getSettings := stateStorageOpts(cmd)
+			projectName := cmd.StringArg("PROJECT_NAME", "", "A project name configured inside backr")
+
+			cmd.Action = func() {
+				currentSettings := getSettings()
+				ctx := backr.NewContextWithSettings(context.Background(), currentSettings)
+				defer state.CleanupStorage(currentSettings)
+
+				project, err := tasks.GetProjectState(ctx, *projectName)
+				if err != nil {
+					fmt.Printf("ERROR: %v\n", err)
+					cli.Exit(1)
+				}
+
+				encoder := json.NewEncoder(os.Stdout)
+				encoder.SetIndent("", "  ")
+				encoder.Encode(project)
+			}
+		})
 	})
 
-	return backr.StateStorageSettings{
-		EtcdEndpoints: etcdEndpoints,
-		LocalPath:     localPath,
+	app.Run(os.Args)
+}
+
+// download writes the content of an URL into a file
+func download(URL string, file string) error {
+	resp, err := http.Get(URL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unable to download the archive: %s", resp.Status)
+	}
+
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(f, resp.Body); err != nil {
+		f.Close()
+		os.Remove(file)
+		return err
+	}
+
+	return f.Close()
+}
+
+// privateAPIClientOpts declares the options needed to reach the private API,
+// and returns a function building the client once the options are parsed
+func privateAPIClientOpts(cmd *cli.Cmd) func() backr.PrivateAPIClient {
+	url := cmd.StringOpt("url", "http://127.0.0.1:22258", "URL of private API (or 'unix:///path/to/socket')")
+	tokenFile := cmd.StringOpt("token-file", "~/.backr/private_api_token", "Path to the file storing the private API token")
+
+	return func() backr.PrivateAPIClient {
+		tokenPath, _ := homedir.Expand(*tokenFile)
+		token, err := privatehttp.ReadTokenFile(tokenPath)
+		if err != nil {
+			fmt.Printf("ERROR: unable to read the token file: %v\n", err)
+			cli.Exit(1)
+		}
+
+		return privatehttp.NewClient(*url, token)
 	}
 }
 
-func startPrivateAPI(ctx context.Context) {
+// parseUntil parses a date, or a duration relative to now (days are supported with the 'd' suffix)
+func parseUntil(value string, now time.Time) (time.Time, error) {
+	if strings.HasSuffix(value, "d") {
+		if days, err := strconv.Atoi(strings.TrimSuffix(value, "d")); err == nil {
+			return now.AddDate(0, 0, days), nil
+		}
+	}
+
+	if duration, err := time.ParseDuration(value); err == nil {
+		return now.Add(duration), nil
+	}
+
+	if date, err := time.Parse(time.RFC3339, value); err == nil {
+		return date, nil
+	}
+
+	for _, layout := range []string{"2006-01-02 15:04", "2006-01-02"} {
+		if date, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return date, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("unable to parse '%s' as a date or a duration", value)
+}
+
+func startPrivateAPI(ctx context.Context, api backr.PrivateAPI) {
 	go func() {
-		api := privatehttp.NewAPI()
-		api.Listen(ctx)
+		err := api.Listen(ctx)
+		if err != nil {
+			log.WithField("err", err).Errorln("Private API stopped")
+		}
 	}()
 }
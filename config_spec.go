@@ -5,17 +5,32 @@ import (
 	"errors"
 	"fmt"
 	"strconv"
+	"time"
 )
 
 // ProjectBackupSpec represents the content of a backup.yml file
 type ProjectBackupSpec struct {
-	Name     string `yaml:"name"`
-	Backups  []BackupSpec
-	Archiver *Archiver `yaml:"archiver"`
+	Name      string `yaml:"name"`
+	Backups   []BackupSpec
+	Archiver  *Archiver        `yaml:"archiver"`
+	Timezone  string           `yaml:"timezone"`  // IANA name like 'Europe/Paris', the daemon time zone is used if empty
+	Window    *BackupWindow    `yaml:"window"`    // overrides the daemon start hour or window
+	Retention *RetentionPolicy `yaml:"retention"` // archives not kept by the policy are deleted after each backup
+	// UploadRateLimit overrides the daemon upload bandwidth limit, like "5MB" or "0,08:00-19:00=5MB" (see ParseRateLimit)
+	UploadRateLimit string `yaml:"upload_rate_limit"`
+	// ArchiveNameTemplate overrides the daemon template naming the archives, like '{{.Date}}/{{.Clock}}-{{.Random}}' (see ArchiveNameData)
+	ArchiveNameTemplate string `yaml:"archive_name_template"`
+	// S3 overrides the daemon options of the objects storing the archives (storage class, encryption, tags...)
+	S3 *S3ObjectSettings `yaml:"s3"`
+	// RestoreTest periodically downloads and restores the latest archive, to check that it is usable
+	RestoreTest *RestoreTestSpec `yaml:"restore_test"`
+	// SizeCheck reports (or fails) the backups whose archive size is abnormal, see DefaultSizeCheck if it is not set
+	SizeCheck *SizeCheckSpec `yaml:"size_check"`
 }
 
 // BackupSpec represents a backup specification
 type BackupSpec struct {
+	TTL               int  `yaml:"ttl"` // time (in days) the archives are kept, used as Object Lock retention
 	MinAge            int  `yaml:"min_age"`
 	PeriodUnit        int  `yaml:"period_unit"` // unit for 'min_age', in hours (default to 24h)
 	IgnoreStartupTime bool `yaml:"ignore_startup_time"`
@@ -50,5 +65,53 @@ func (b ProjectBackupSpec) IsValid() error {
 		return errors.New("'backups' cannot be empty")
 	}
 
+	if b.Timezone != "" {
+		if _, err := time.LoadLocation(b.Timezone); err != nil {
+			return fmt.Errorf("'timezone' is not valid: %v", err)
+		}
+	}
+
+	if b.Window != nil {
+		if err := b.Window.Validate(); err != nil {
+			return fmt.Errorf("'window' is not valid: %v", err)
+		}
+	}
+
+	if b.Retention != nil {
+		if err := b.Retention.Validate(); err != nil {
+			return fmt.Errorf("'retention' is not valid: %v", err)
+		}
+	}
+
+	if b.UploadRateLimit != "" {
+		if _, err := ParseRateLimit(b.UploadRateLimit); err != nil {
+			return fmt.Errorf("'upload_rate_limit' is not valid: %v", err)
+		}
+	}
+
+	if b.ArchiveNameTemplate != "" {
+		if err := ValidateArchiveNameTemplate(b.ArchiveNameTemplate); err != nil {
+			return fmt.Errorf("'archive_name_template' is not valid: %v", err)
+		}
+	}
+
+	if b.S3 != nil {
+		if err := b.S3.Validate(); err != nil {
+			return fmt.Errorf("'s3' is not valid: %v", err)
+		}
+	}
+
+	if b.RestoreTest != nil {
+		if err := b.RestoreTest.Validate(); err != nil {
+			return fmt.Errorf("'restore_test' is not valid: %v", err)
+		}
+	}
+
+	if b.SizeCheck != nil {
+		if err := b.SizeCheck.Validate(); err != nil {
+			return fmt.Errorf("'size_check' is not valid: %v", err)
+		}
+	}
+
 	return nil
 }
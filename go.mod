@@ -4,14 +4,13 @@ go 1.13
 
 require (
 	github.com/boltdb/bolt v1.3.0
-	github.com/dgrijalva/jwt-go v3.0.0+incompatible
 	github.com/jawher/mow.cli v0.0.0-20160221171641-772320464101
 	github.com/kr/pretty v0.1.0 // indirect
-	github.com/minio/minio-go/v6 v6.0.44
+	github.com/lib/pq v1.10.9
+	github.com/minio/minio-go/v6 v6.0.57
 	github.com/mitchellh/go-homedir v1.1.0
-	github.com/sirupsen/logrus v1.4.2
-	golang.org/x/crypto v0.0.0-20191206172530-e9b2fee46413 // indirect
-	golang.org/x/net v0.0.0-20191209160850-c0dbc17a3553 // indirect
+	github.com/sirupsen/logrus v1.5.0
 	gopkg.in/check.v1 v1.0.0-20190902080502-41f04d3bba15 // indirect
 	gopkg.in/yaml.v2 v2.0.0-20160301204022-a83829b6f129
+	modernc.org/sqlite v1.20.4
 )
@@ -0,0 +1,42 @@
+package backr
+
+import "time"
+
+// JobState represents the lifecycle state of a manual backup job
+type JobState string
+
+const (
+	JobQueued    JobState = "queued"
+	JobRunning   JobState = "running"
+	JobSucceeded JobState = "succeeded"
+	JobFailed    JobState = "failed"
+	JobCancelled JobState = "cancelled"
+)
+
+// JobProgress represents the current step of a running job
+type JobProgress string
+
+const (
+	JobProgressPending   JobProgress = "pending"
+	JobProgressArchiving JobProgress = "archiving"
+	JobProgressUploading JobProgress = "uploading"
+	JobProgressDone      JobProgress = "done"
+)
+
+// Job represents a backup executed asynchronously through the private API
+type Job struct {
+	ID         string               `json:"id"`
+	Project    string               `json:"project"`
+	State      JobState             `json:"state"`
+	Progress   JobProgress          `json:"progress"`
+	CreatedAt  time.Time            `json:"created_at"`
+	StartedAt  time.Time            `json:"started_at"`
+	FinishedAt time.Time            `json:"finished_at"`
+	Result     *UploadedArchiveInfo `json:"result,omitempty"`
+	Error      string               `json:"error,omitempty"`
+}
+
+// IsFinished returns true if the job will not change anymore
+func (j Job) IsFinished() bool {
+	return j.State == JobSucceeded || j.State == JobFailed || j.State == JobCancelled
+}
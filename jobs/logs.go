@@ -0,0 +1,105 @@
+package jobs
+
+import (
+	"context"
+	"io"
+	"sync"
+)
+
+// maxLogSize is the maximum amount of output kept for a single job
+const maxLogSize = 1 << 20
+
+// logBuffer stores the output of a job and allows readers to follow it until the job is finished
+type logBuffer struct {
+	mu        sync.Mutex
+	data      []byte
+	truncated bool
+	closed    bool
+	changed   chan struct{}
+}
+
+func newLogBuffer() *logBuffer {
+	return &logBuffer{changed: make(chan struct{})}
+}
+
+// Write implements io.Writer. Output exceeding maxLogSize is dropped, without failing the writer.
+func (b *logBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return len(p), nil
+	}
+
+	available := maxLogSize - len(b.data)
+	if available <= 0 {
+		if !b.truncated {
+			b.truncated = true
+			b.data = append(b.data, []byte("\n[output truncated]\n")...)
+			b.notify()
+		}
+		return len(p), nil
+	}
+
+	if len(p) > available {
+		b.data = append(b.data, p[:available]...)
+	} else {
+		b.data = append(b.data, p...)
+	}
+	b.notify()
+
+	return len(p), nil
+}
+
+// Close marks the end of the output: followers return once everything has been read
+func (b *logBuffer) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.closed {
+		b.closed = true
+		b.notify()
+	}
+	return nil
+}
+
+// notify wakes up the followers. Must be called with the lock held.
+func (b *logBuffer) notify() {
+	close(b.changed)
+	b.changed = make(chan struct{})
+}
+
+// Follow copies the output to w as soon as it is written, until the buffer is closed or ctx is done.
+// flush is called after each write (can be nil).
+func (b *logBuffer) Follow(ctx context.Context, w io.Writer, flush func()) error {
+	offset := 0
+
+	for {
+		b.mu.Lock()
+		chunk := b.data[offset:]
+		closed := b.closed
+		changed := b.changed
+		b.mu.Unlock()
+
+		if len(chunk) > 0 {
+			if _, err := w.Write(chunk); err != nil {
+				return err
+			}
+			if flush != nil {
+				flush()
+			}
+			offset += len(chunk)
+			continue
+		}
+
+		if closed {
+			return nil
+		}
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
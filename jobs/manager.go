@@ -0,0 +1,240 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"time"
+	"webup/backr"
+	"webup/backr/archive"
+	"webup/backr/logging"
+	"webup/backr/randstr"
+	"webup/backr/tasks"
+
+	"github.com/sirupsen/logrus"
+)
+
+var log = logging.Logger(logging.Jobs)
+
+// finished jobs are forgotten after this delay
+const jobRetention = 24 * time.Hour
+
+// ErrShuttingDown is returned when a job is started while the manager is shutting down
+var ErrShuttingDown = errors.New("Backr is shutting down")
+
+// Manager keeps track of the backups started asynchronously through the private API
+type Manager struct {
+	mu     sync.Mutex
+	jobs   map[string]*entry
+	closed bool
+}
+
+type entry struct {
+	job    backr.Job
+	cancel context.CancelFunc
+	logs   *logBuffer
+	done   chan struct{}
+}
+
+// NewManager returns an empty job manager
+func NewManager() *Manager {
+	return &Manager{jobs: map[string]*entry{}}
+}
+
+// Start creates a job performing a standalone backup of a project in background.
+// The job is bound to ctx: cancelling it cancels the job.
+// The job keeps the settings of ctx at its start, even if they are reloaded meanwhile.
+// It returns ErrShuttingDown once Shutdown is called.
+func (m *Manager) Start(ctx context.Context, projectName string) (backr.Job, error) {
+	if settings, ok := backr.SettingsFromContext(ctx); ok {
+		ctx = backr.NewContextWithSettings(ctx, settings)
+	}
+	jobCtx, cancel := context.WithCancel(ctx)
+
+	e := &entry{
+		job: backr.Job{
+			ID:        randstr.SecureRandomAlphaString(16),
+			Project:   projectName,
+			State:     backr.JobQueued,
+			Progress:  backr.JobProgressPending,
+			CreatedAt: time.Now(),
+		},
+		cancel: cancel,
+		logs:   newLogBuffer(),
+		done:   make(chan struct{}),
+	}
+
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		cancel()
+		return backr.Job{}, ErrShuttingDown
+	}
+	m.prune()
+	m.jobs[e.job.ID] = e
+	job := e.job
+	m.mu.Unlock()
+
+	go m.run(jobCtx, e)
+
+	return job, nil
+}
+
+// Shutdown refuses the new jobs and waits for the running ones. If ctx is done before they are finished,
+// they are cancelled, and Shutdown waits for them to record their result before returning the error of ctx.
+func (m *Manager) Shutdown(ctx context.Context) error {
+	m.mu.Lock()
+	m.closed = true
+	running := []*entry{}
+	for _, e := range m.jobs {
+		if !e.job.IsFinished() {
+			running = append(running, e)
+		}
+	}
+	m.mu.Unlock()
+
+	var err error
+wait:
+	for _, e := range running {
+		select {
+		case <-e.done:
+		case <-ctx.Done():
+			err = ctx.Err()
+			break wait
+		}
+	}
+
+	if err != nil {
+		for _, e := range running {
+			e.cancel()
+		}
+		for _, e := range running {
+			<-e.done
+		}
+	}
+
+	return err
+}
+
+func (m *Manager) run(ctx context.Context, e *entry) {
+	defer close(e.done)
+	defer e.logs.Close()
+	defer e.cancel()
+
+	m.update(e, func(job *backr.Job) {
+		job.State = backr.JobRunning
+		job.StartedAt = time.Now()
+	})
+
+	logEntry := log.WithFields(logrus.Fields{
+		"job_id":  e.job.ID,
+		"project": e.job.Project,
+	})
+	logEntry.Infoln("Job started")
+
+	options := archive.Options{
+		ReturnBackupURL: true,
+		Output:          e.logs,
+		Progress: func(progress backr.JobProgress) {
+			m.update(e, func(job *backr.Job) {
+				job.Progress = progress
+			})
+		},
+	}
+
+	info, err := tasks.PerformStandaloneBackup(ctx, e.job.Project, options)
+
+	m.update(e, func(job *backr.Job) {
+		job.FinishedAt = time.Now()
+
+		switch {
+		case err != nil && ctx.Err() == context.Canceled:
+			job.State = backr.JobCancelled
+			job.Error = "job cancelled"
+		case err != nil:
+			job.State = backr.JobFailed
+			job.Error = err.Error()
+		default:
+			job.State = backr.JobSucceeded
+			job.Progress = backr.JobProgressDone
+			job.Result = info
+		}
+	})
+
+	job, _ := m.Get(e.job.ID)
+	logEntry.WithField("state", job.State).Infoln("Job finished")
+}
+
+func (m *Manager) update(e *entry, f func(job *backr.Job)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	f(&e.job)
+}
+
+// prune removes the old finished jobs. Must be called with the lock held.
+func (m *Manager) prune() {
+	limit := time.Now().Add(-jobRetention)
+	for id, e := range m.jobs {
+		if e.job.IsFinished() && e.job.FinishedAt.Before(limit) {
+			delete(m.jobs, id)
+		}
+	}
+}
+
+func (m *Manager) get(id string) (*entry, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.jobs[id]
+	return e, ok
+}
+
+// Get returns a snapshot of a job
+func (m *Manager) Get(id string) (backr.Job, bool) {
+	e, ok := m.get(id)
+	if !ok {
+		return backr.Job{}, false
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return e.job, true
+}
+
+// Cancel requests the cancellation of a job and returns its current snapshot
+func (m *Manager) Cancel(id string) (backr.Job, bool) {
+	e, ok := m.get(id)
+	if !ok {
+		return backr.Job{}, false
+	}
+
+	e.cancel()
+
+	return m.Get(id)
+}
+
+// Wait blocks until the job is finished or ctx is done, and returns its snapshot
+func (m *Manager) Wait(ctx context.Context, id string) (backr.Job, bool) {
+	e, ok := m.get(id)
+	if !ok {
+		return backr.Job{}, false
+	}
+
+	select {
+	case <-e.done:
+	case <-ctx.Done():
+	}
+
+	return m.Get(id)
+}
+
+// FollowLogs copies the archiver output of a job to w until the job is finished or ctx is done.
+// It returns false if the job doesn't exist.
+func (m *Manager) FollowLogs(ctx context.Context, id string, w io.Writer, flush func()) (bool, error) {
+	e, ok := m.get(id)
+	if !ok {
+		return false, nil
+	}
+
+	return true, e.logs.Follow(ctx, w, flush)
+}
@@ -0,0 +1,125 @@
+package logging
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Subsystems using a dedicated logger
+const (
+	Scheduler = "scheduler"
+	Archive   = "archive"
+	S3        = "s3"
+	Bolt      = "bolt"
+	SQL       = "sql"
+	State     = "state"
+	API       = "api"
+	Jobs      = "jobs"
+)
+
+// Config represents the logging configuration
+type Config struct {
+	// Format is 'text' or 'json'
+	Format string
+	// Level is the default level, Levels overrides it for some subsystems
+	Level  logrus.Level
+	Levels map[string]logrus.Level
+	Output io.Writer
+}
+
+var (
+	mu      sync.Mutex
+	config  = Config{Format: "text", Level: logrus.InfoLevel, Output: os.Stderr}
+	loggers = map[string]*logrus.Logger{}
+)
+
+// Logger returns the logger of a subsystem. It can be called before Configure:
+// the configuration is applied to the existing loggers.
+func Logger(subsystem string) *logrus.Entry {
+	mu.Lock()
+	defer mu.Unlock()
+
+	logger, ok := loggers[subsystem]
+	if !ok {
+		logger = logrus.New()
+		apply(logger, subsystem)
+		loggers[subsystem] = logger
+	}
+
+	return logger.WithField("subsystem", subsystem)
+}
+
+// Configure applies a configuration to every logger, including the standard one
+func Configure(c Config) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	config = c
+	for subsystem, logger := range loggers {
+		apply(logger, subsystem)
+	}
+	apply(logrus.StandardLogger(), "")
+}
+
+// apply configures a logger. Must be called with the lock held.
+func apply(logger *logrus.Logger, subsystem string) {
+	if config.Format == "json" {
+		logger.SetFormatter(&logrus.JSONFormatter{})
+	} else {
+		logger.SetFormatter(&logrus.TextFormatter{FullTimestamp: true})
+	}
+
+	logger.SetOutput(config.Output)
+
+	if level, ok := config.Levels[subsystem]; ok {
+		logger.SetLevel(level)
+	} else {
+		logger.SetLevel(config.Level)
+	}
+}
+
+// ParseLevels parses a list of levels like "info,scheduler=debug,bolt=warn".
+// The item without subsystem is the default level.
+func ParseLevels(value string) (logrus.Level, map[string]logrus.Level, error) {
+	defaultLevel := logrus.InfoLevel
+	levels := map[string]logrus.Level{}
+
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		subsystem := ""
+		if i := strings.Index(item, "="); i >= 0 {
+			subsystem = item[:i]
+			item = item[i+1:]
+		}
+
+		level, err := logrus.ParseLevel(item)
+		if err != nil {
+			return defaultLevel, nil, err
+		}
+
+		if subsystem == "" {
+			defaultLevel = level
+		} else {
+			levels[subsystem] = level
+		}
+	}
+
+	return defaultLevel, levels, nil
+}
+
+// ParseFormat checks a log format
+func ParseFormat(value string) (string, error) {
+	if value != "text" && value != "json" {
+		return "", fmt.Errorf("log format must be 'text' or 'json'")
+	}
+	return value, nil
+}
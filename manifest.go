@@ -0,0 +1,132 @@
+package backr
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// Version is the version of backr, written in the manifests of the archives
+const Version = "5 (build 10)"
+
+// ManifestVersion is the version of the format of the manifests
+const ManifestVersion = 1
+
+// ManifestSuffix is appended to the name of an archive to name its manifest, stored next to it
+const ManifestSuffix = ".manifest.json"
+
+// ArchiveManifest describes an archive and what produced it, so that an object found in a bucket is self-describing
+type ArchiveManifest struct {
+	Version int `json:"version"`
+	// Archive is the name of the object storing the archive
+	Archive      string `json:"archive"`
+	Project      string `json:"project"`
+	Host         string `json:"host"`
+	BackrVersion string `json:"backr_version"`
+	// Archiver is 'pliz' or 'stdout', and Command the command it has executed
+	Archiver string   `json:"archiver"`
+	Command  []string `json:"command"`
+	// Backup is the checksum of the backup spec, empty for the manual backups
+	Backup     string    `json:"backup,omitempty"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	Size       int64     `json:"size"`
+	SHA256     string    `json:"sha256"`
+	// Encryption is the server-side encryption of the object ('sse-s3', 'sse-kms' or 'sse-c'), empty if it is not encrypted
+	Encryption string `json:"encryption,omitempty"`
+	KMSKeyID   string `json:"kms_key_id,omitempty"`
+	// Compression is guessed from the extension of the archive ('gzip', 'bzip2'...), empty if unknown
+	Compression string `json:"compression,omitempty"`
+	// TTL is the number of days the archive is kept, and ExpiresAt the end of this period (nil without TTL)
+	TTL       int        `json:"ttl"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	// LockMode is the Object Lock mode protecting the archive until its expiry, if any
+	LockMode string `json:"lock_mode,omitempty"`
+}
+
+// ManifestName returns the name of the object storing the manifest of an archive
+func ManifestName(archive string) string {
+	return archive + ManifestSuffix
+}
+
+// IsManifestName tells if an object stores the manifest of an archive
+func IsManifestName(name string) bool {
+	return strings.HasSuffix(name, ManifestSuffix)
+}
+
+// Describes checks that a stored archive is the one described by the manifest, without downloading it
+func (m ArchiveManifest) Describes(archive Archive) error {
+	if m.Archive != archive.Name {
+		return fmt.Errorf("the manifest describes another archive (%s)", m.Archive)
+	}
+	if m.Size != archive.Size {
+		return fmt.Errorf("the archive size (%d bytes) differs from its manifest (%d bytes)", archive.Size, m.Size)
+	}
+
+	return nil
+}
+
+// Verify checks that a downloaded archive matches its manifest
+func (m ArchiveManifest) Verify(file string) error {
+	size, sum, err := FileChecksum(file)
+	if err != nil {
+		return err
+	}
+
+	if size != m.Size {
+		return fmt.Errorf("the archive size (%d bytes) differs from its manifest (%d bytes)", size, m.Size)
+	}
+	if sum != m.SHA256 {
+		return fmt.Errorf("the archive SHA-256 (%s) differs from its manifest (%s)", sum, m.SHA256)
+	}
+
+	return nil
+}
+
+// FileChecksum returns the size of a file and its hex-encoded SHA-256
+func FileChecksum(file string) (int64, string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return 0, "", err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, f)
+	if err != nil {
+		return 0, "", err
+	}
+
+	return size, hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// Compression returns the compression of an archive guessed from its extension, empty if unknown
+func Compression(fileExt string) string {
+	ext := fileExt
+	if i := strings.LastIndex(fileExt, "."); i >= 0 {
+		ext = fileExt[i+1:]
+	}
+
+	switch strings.ToLower(ext) {
+	case "gz", "tgz":
+		return "gzip"
+	case "bz2", "tbz2":
+		return "bzip2"
+	case "xz", "txz":
+		return "xz"
+	case "zst":
+		return "zstd"
+	case "lz4":
+		return "lz4"
+	case "zip":
+		return "zip"
+	case "7z":
+		return "7z"
+	}
+
+	return ""
+}
@@ -0,0 +1,74 @@
+package memory
+
+import (
+	"context"
+	"time"
+	"webup/backr"
+	"webup/backr/randstr"
+)
+
+// Acquire takes the lease of name for ttl. If another valid lease exists, it is returned with ErrLeaseHeld (Locker interface)
+func (s *Storage) Acquire(ctx context.Context, name string, holder string, ttl time.Duration) (backr.Lease, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if current, ok := s.leases[name]; ok && current.IsValid(now) {
+		return current, backr.ErrLeaseHeld
+	}
+
+	lease := backr.Lease{
+		Name:       name,
+		Holder:     holder,
+		Token:      randstr.SecureRandomAlphaString(16),
+		AcquiredAt: now,
+		ExpiresAt:  now.Add(ttl),
+	}
+	s.leases[name] = lease
+
+	return lease, nil
+}
+
+// Renew extends a lease for ttl, returning ErrLeaseLost if it is not owned anymore (Locker interface)
+func (s *Storage) Renew(ctx context.Context, lease backr.Lease, ttl time.Duration) (backr.Lease, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// an expired lease is still owned, as long as nobody else acquired it
+	if current, ok := s.leases[lease.Name]; !ok || current.Token != lease.Token {
+		return lease, backr.ErrLeaseLost
+	}
+
+	lease.ExpiresAt = time.Now().Add(ttl)
+	s.leases[lease.Name] = lease
+
+	return lease, nil
+}
+
+// Release gives up a lease, if it is still owned (Locker interface)
+func (s *Storage) Release(ctx context.Context, lease backr.Lease) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if current, ok := s.leases[lease.Name]; ok && current.Token == lease.Token {
+		delete(s.leases, lease.Name)
+	}
+
+	return nil
+}
+
+// Leases returns the valid leases, by name (Locker interface)
+func (s *Storage) Leases(ctx context.Context) (map[string]backr.Lease, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	leases := map[string]backr.Lease{}
+	for name, lease := range s.leases {
+		if lease.IsValid(now) {
+			leases[name] = lease
+		}
+	}
+
+	return leases, nil
+}
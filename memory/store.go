@@ -0,0 +1,122 @@
+package memory
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"webup/backr"
+)
+
+// Storage implements the StateStorage interface to keep the state in memory: it is lost when the process exits.
+// It is meant for ephemeral runs, like CI, and for the tests.
+type Storage struct {
+	mu sync.Mutex
+	// the projects are stored encoded, so that the callers never share them
+	projects map[string][]byte
+	leases   map[string]backr.Lease
+}
+
+// storage is shared by the GetStorage calls, as the state must outlive them
+var storage = New()
+
+// New returns an empty storage
+func New() *Storage {
+	return &Storage{
+		projects: map[string][]byte{},
+		leases:   map[string]backr.Lease{},
+	}
+}
+
+// GetStorage returns the in-memory storage of the process
+func GetStorage(opts backr.Settings) (backr.StateStorer, error) {
+	return storage, nil
+}
+
+// Cleanup does nothing: the state is kept until the process exits
+func (s *Storage) Cleanup() {
+}
+
+// ConfiguredProjects returns the configured projects (Storer interface)
+func (s *Storage) ConfiguredProjects(ctx context.Context) (map[string]backr.Project, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	projects := map[string]backr.Project{}
+	for name, jsonData := range s.projects {
+		project, err := backr.ProjectFromJSON(string(jsonData))
+		if err != nil {
+			return nil, fmt.Errorf("Unable to decode the project '%s': %v", name, err)
+		}
+		projects[name] = project
+	}
+
+	return projects, nil
+}
+
+// GetProject returns a project (Storer interface)
+func (s *Storage) GetProject(ctx context.Context, name string) (*backr.Project, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	jsonData, ok := s.projects[name]
+	if !ok {
+		return nil, nil
+	}
+
+	project, err := backr.ProjectFromJSON(string(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("Unable to decode the project '%s': %v", name, err)
+	}
+
+	return &project, nil
+}
+
+// SaveProject store a project (Storer interface)
+func (s *Storage) SaveProject(ctx context.Context, project backr.Project) error {
+	jsonData, err := json.Marshal(project)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.projects[project.Name] = jsonData
+	return nil
+}
+
+// UpdateProject applies update to a stored project, under the lock of the storage (Storer interface)
+func (s *Storage) UpdateProject(ctx context.Context, name string, update func(project *backr.Project)) (*backr.Project, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	jsonData, ok := s.projects[name]
+	if !ok {
+		return nil, nil
+	}
+
+	project, err := backr.ProjectFromJSON(string(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("Unable to decode the project '%s': %v", name, err)
+	}
+
+	update(&project)
+
+	jsonData, err = json.Marshal(project)
+	if err != nil {
+		return nil, err
+	}
+	s.projects[name] = jsonData
+
+	return &project, nil
+}
+
+// DeleteProject removes a project (Storer interface)
+func (s *Storage) DeleteProject(ctx context.Context, project backr.Project) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.projects, project.Name)
+	return nil
+}
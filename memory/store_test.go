@@ -0,0 +1,13 @@
+package memory
+
+import (
+	"testing"
+	"webup/backr"
+	"webup/backr/statetest"
+)
+
+func TestStorage(t *testing.T) {
+	statetest.Run(t, func(t *testing.T) backr.StateStorer {
+		return New()
+	})
+}
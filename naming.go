@@ -0,0 +1,117 @@
+package backr
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+	"webup/backr/randstr"
+)
+
+// DefaultArchiveNameTemplate names the archives with their creation time, like '2020-03-14T01:02:03+01:00'
+const DefaultArchiveNameTemplate = `{{.Time.Format "2006-01-02T15:04:05Z07:00"}}`
+
+// ArchiveNameData are the variables of the templates naming the archives (Go text/template syntax, like '{{.Date}}-{{.Random}}')
+type ArchiveNameData struct {
+	Project  string
+	Host     string
+	Backup   string // checksum of the backup
+	Archiver string // 'pliz' or 'stdout'
+	// Time is the creation time of the archive, allowing other layouts like '{{.Time.Format "20060102"}}'
+	Time time.Time
+	// Date ('2006-01-02'), Clock ('150405') and the date parts are zero-padded
+	Date   string
+	Clock  string
+	Year   string
+	Month  string
+	Day    string
+	Hour   string
+	Minute string
+	Second string
+	Unix   int64
+	// Random is a random suffix, which avoids the collisions of the archives created in the same second
+	Random string
+}
+
+// NewArchiveNameData returns the variables naming an archive of a project created at the given time
+func NewArchiveNameData(project Project, backup Backup, t time.Time) ArchiveNameData {
+	host, _ := os.Hostname()
+
+	return ArchiveNameData{
+		Project:  project.Name,
+		Host:     host,
+		Backup:   backup.Checksum,
+		Archiver: project.Archiver.Type,
+		Time:     t,
+		Date:     t.Format("2006-01-02"),
+		Clock:    t.Format("150405"),
+		Year:     t.Format("2006"),
+		Month:    t.Format("01"),
+		Day:      t.Format("02"),
+		Hour:     t.Format("15"),
+		Minute:   t.Format("04"),
+		Second:   t.Format("05"),
+		Unix:     t.Unix(),
+		Random:   strings.ToLower(randstr.SecureRandomAlphaString(8)),
+	}
+}
+
+// ValidateArchiveNameTemplate checks that a template can be parsed, and renders a valid name
+func ValidateArchiveNameTemplate(value string) error {
+	sample := Project{Name: "project", Archiver: Archiver{Type: "pliz"}}
+	_, err := RenderArchiveName(value, NewArchiveNameData(sample, Backup{Checksum: "checksum"}, time.Now()))
+	return err
+}
+
+// RenderArchiveName returns the name of an archive, relative to the prefix of its project and without its extension
+func RenderArchiveName(value string, data ArchiveNameData) (string, error) {
+	tmpl, err := template.New("archive").Parse(value)
+	if err != nil {
+		return "", err
+	}
+
+	var name strings.Builder
+	if err := tmpl.Execute(&name, data); err != nil {
+		return "", err
+	}
+
+	if err := validateArchiveName(name.String()); err != nil {
+		return "", err
+	}
+
+	return name.String(), nil
+}
+
+// validateArchiveName checks that a name stays inside the prefix of its project
+func validateArchiveName(name string) error {
+	if strings.TrimSpace(name) == "" {
+		return errors.New("the archive name is empty")
+	}
+
+	for _, c := range name {
+		if c < ' ' || c == 0x7f {
+			return fmt.Errorf("the archive name %q contains control characters", name)
+		}
+	}
+
+	for _, part := range strings.Split(name, "/") {
+		if part == "" || part == "." || part == ".." {
+			return fmt.Errorf("the archive name '%s' must be a relative path, without empty, '.' or '..' parts", name)
+		}
+	}
+
+	return nil
+}
+
+// GetArchiveNameTemplate returns the template naming the archives of the project, defaulting to the one of the settings
+func (p Project) GetArchiveNameTemplate(settings Settings) string {
+	if p.ArchiveNameTemplate != "" {
+		return p.ArchiveNameTemplate
+	}
+	if settings.ArchiveNameTemplate != "" {
+		return settings.ArchiveNameTemplate
+	}
+	return DefaultArchiveNameTemplate
+}
@@ -3,21 +3,37 @@ package privatehttp
 import (
 	"context"
 	"encoding/json"
+	"net"
 	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 	"webup/backr"
+	"webup/backr/logging"
 
 	"fmt"
 
+	"webup/backr/jobs"
+	"webup/backr/state"
 	"webup/backr/tasks"
-
-	log "github.com/sirupsen/logrus"
 )
 
+var log = logging.Logger(logging.API)
+
 type HTTPApi struct {
+	jobs   *jobs.Manager
+	tokens []backr.APIToken
+
+	mu      sync.Mutex
+	servers []*http.Server
 }
 
 func NewAPI() backr.PrivateAPI {
-	return &HTTPApi{}
+	return &HTTPApi{
+		jobs: jobs.NewManager(),
+	}
 }
 
 func (api *HTTPApi) Listen(ctx context.Context) error {
@@ -27,21 +43,113 @@ func (api *HTTPApi) Listen(ctx context.Context) error {
 		return fmt.Errorf("Unable to get options from context")
 	}
 
-	http.HandleFunc("/actions/backup", api.Backup(ctx))
+	tokens, err := setupTokens(opts.PrivateAPI)
+	if err != nil {
+		return err
+	}
+	api.tokens = tokens
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/actions/backup", api.authenticate(backr.ScopeTrigger, api.Backup(ctx)))
+	mux.HandleFunc("/jobs", api.authenticate(backr.ScopeTrigger, api.CreateJob(ctx)))
+	mux.HandleFunc("/jobs/", api.Job(ctx))
+	mux.HandleFunc("/status", api.authenticate(backr.ScopeStatus, api.Status(ctx)))
+	mux.HandleFunc("/metrics", api.authenticate(backr.ScopeStatus, api.Metrics(ctx)))
+	mux.HandleFunc("/projects/", api.Project(ctx))
+
+	listeners := []net.Listener{}
+
+	if opts.PrivateAPIListen != "" {
+		listener, err := net.Listen("tcp", opts.PrivateAPIListen)
+		if err != nil {
+			return err
+		}
+		listeners = append(listeners, listener)
+	}
+
+	if opts.PrivateAPI.Socket != "" {
+		listener, err := listenUnix(opts.PrivateAPI.Socket, opts.PrivateAPI.SocketMode)
+		if err != nil {
+			return err
+		}
+		listeners = append(listeners, listener)
+	}
+
+	if len(listeners) == 0 {
+		return fmt.Errorf("Private API has no address nor socket to listen on")
+	}
+
+	errs := make(chan error, len(listeners))
+	for _, listener := range listeners {
+		log.Infof("Private API listening on %v", listener.Addr())
+
+		server := &http.Server{Handler: mux}
+		api.mu.Lock()
+		api.servers = append(api.servers, server)
+		api.mu.Unlock()
+
+		go func(listener net.Listener) {
+			errs <- server.Serve(listener)
+		}(listener)
+	}
 
-	log.Infof("Private API listening on %v", opts.PrivateAPIListen)
-	return http.ListenAndServe(opts.PrivateAPIListen, nil)
+	if err := <-errs; err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+// Shutdown stops accepting requests and jobs, then waits for the running requests and jobs.
+// When ctx is done, the remaining connections are closed and the remaining jobs are cancelled.
+func (api *HTTPApi) Shutdown(ctx context.Context) error {
+	api.mu.Lock()
+	servers := api.servers
+	api.mu.Unlock()
+
+	// the new jobs are refused while the requests still running finish
+	jobsErr := make(chan error, 1)
+	go func() {
+		jobsErr <- api.jobs.Shutdown(ctx)
+	}()
+
+	var err error
+	for _, server := range servers {
+		if shutdownErr := server.Shutdown(ctx); shutdownErr != nil {
+			server.Close()
+			err = shutdownErr
+		}
+	}
+
+	if shutdownErr := <-jobsErr; shutdownErr != nil {
+		err = shutdownErr
+	}
+
+	return err
 }
 
+// listenUnix listens on a unix socket, replacing a stale one, and restricts its permissions
+func listenUnix(path string, mode os.FileMode) (net.Listener, error) {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("Unable to remove the existing socket: %w", err)
+	}
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.Chmod(path, mode); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("Unable to set socket permissions: %w", err)
+	}
+
+	return listener, nil
+}
+
+// Backup starts a backup job and waits for its result (kept for compatibility with old clients)
 func (api *HTTPApi) Backup(ctx context.Context) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 
-		// opts, ok := backr.SettingsFromContext(ctx)
-		// if !ok {
-		// 	w.WriteHeader(http.StatusInternalServerError)
-		// 	return
-		// }
-
 		// get 'name' param
 		name := r.URL.Query().Get("name")
 		if name == "" {
@@ -50,17 +158,323 @@ func (api *HTTPApi) Backup(ctx context.Context) http.HandlerFunc {
 			return
 		}
 
-		info, err := tasks.PerformStandaloneBackup(ctx, name)
+		if status, err := checkProject(ctx, name); err != nil {
+			w.WriteHeader(status)
+			fmt.Fprintln(w, err)
+			return
+		}
+
+		job, err := api.jobs.Start(ctx, name)
 		if err != nil {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprintln(w, err)
+			return
+		}
+		job, _ = api.jobs.Wait(r.Context(), job.ID)
+
+		if job.State != backr.JobSucceeded {
 			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintln(w, job.Error)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+
+		job = filterJob(r, job)
+		if job.Result != nil {
+			json.NewEncoder(w).Encode(job.Result)
+		}
+	}
+}
+
+// CreateJob starts a backup job: POST /jobs with a body like {"project": "name"}
+func (api *HTTPApi) CreateJob(ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		var body struct {
+			Project string `json:"project"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Project == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintln(w, "'project' is required")
+			return
+		}
+
+		if status, err := checkProject(ctx, body.Project); err != nil {
+			w.WriteHeader(status)
+			fmt.Fprintln(w, err)
+			return
+		}
+
+		job, err := api.jobs.Start(ctx, body.Project)
+		if err != nil {
+			w.WriteHeader(http.StatusServiceUnavailable)
 			fmt.Fprintln(w, err)
 			return
 		}
 
+		w.Header().Set("Location", "/jobs/"+job.ID)
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(filterJob(r, job))
+	}
+}
+
+// Job handles the requests on a single job:
+// GET /jobs/{id}, DELETE /jobs/{id} and GET /jobs/{id}/logs
+func (api *HTTPApi) Job(ctx context.Context) http.HandlerFunc {
+	getJob := api.authenticate(backr.ScopeStatus, func(w http.ResponseWriter, r *http.Request) {
+		job, ok := api.jobs.Get(jobID(r))
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprintln(w, "Job not found")
+			return
+		}
+		json.NewEncoder(w).Encode(filterJob(r, job))
+	})
+
+	cancelJob := api.authenticate(backr.ScopeTrigger, func(w http.ResponseWriter, r *http.Request) {
+		job, ok := api.jobs.Cancel(jobID(r))
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprintln(w, "Job not found")
+			return
+		}
+		json.NewEncoder(w).Encode(filterJob(r, job))
+	})
+
+	jobLogs := api.authenticate(backr.ScopeStatus, func(w http.ResponseWriter, r *http.Request) {
+		id := jobID(r)
+		if _, ok := api.jobs.Get(id); !ok {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprintln(w, "Job not found")
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 		w.WriteHeader(http.StatusOK)
 
-		if info != nil {
-			json.NewEncoder(w).Encode(info)
+		flush := func() {}
+		if flusher, ok := w.(http.Flusher); ok {
+			flush = flusher.Flush
+		}
+		api.jobs.FollowLogs(r.Context(), id, w, flush)
+	})
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/jobs/"), "/")
+
+		switch {
+		case len(parts) == 1 && r.Method == http.MethodGet:
+			getJob(w, r)
+		case len(parts) == 1 && r.Method == http.MethodDelete:
+			cancelJob(w, r)
+		case len(parts) == 2 && parts[1] == "logs" && r.Method == http.MethodGet:
+			jobLogs(w, r)
+		default:
+			w.WriteHeader(http.StatusNotFound)
 		}
 	}
 }
+
+func jobID(r *http.Request) string {
+	return strings.Split(strings.TrimPrefix(r.URL.Path, "/jobs/"), "/")[0]
+}
+
+// Status returns the status of the configured projects
+func (api *HTTPApi) Status(ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		status, err := tasks.GetStatus(ctx)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintln(w, err)
+			return
+		}
+
+		json.NewEncoder(w).Encode(status)
+	}
+}
+
+// Project handles the requests on a project:
+// POST /projects/{name}/pause (with an optional body like {"until": "2006-01-02T15:04:05Z"}),
+// POST /projects/{name}/resume, POST /projects/{name}/skip-next,
+// POST /projects/{name}/prune (with an optional 'dry_run=true' query param), POST /projects/{name}/restore-test,
+// GET /projects/{name}/runs and GET /projects/{name}/runs/{id} (0 for the last run),
+// GET /projects/{name}/runs/{id}/verify to check the archive of a run on each destination,
+// GET /projects/{name}/runs/{id}/archive (with an optional 'destination' query param) to get a download URL
+func (api *HTTPApi) Project(ctx context.Context) http.HandlerFunc {
+	projectAction := api.authenticate(backr.ScopeTrigger, func(w http.ResponseWriter, r *http.Request) {
+
+		parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/projects/"), "/")
+		name := parts[0]
+
+		var err error
+		switch parts[1] {
+		case "pause":
+			var body struct {
+				Until time.Time `json:"until"`
+			}
+			if r.ContentLength != 0 {
+				if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+					w.WriteHeader(http.StatusBadRequest)
+					fmt.Fprintln(w, "'until' must be a RFC3339 date")
+					return
+				}
+			}
+			err = tasks.PauseProject(ctx, name, body.Until)
+		case "resume":
+			err = tasks.ResumeProject(ctx, name)
+		case "skip-next":
+			err = tasks.SkipNextBackup(ctx, name)
+		case "prune":
+			var decisions []backr.PruneDecision
+			decisions, err = tasks.PruneProject(ctx, name, r.URL.Query().Get("dry_run") == "true")
+			if err == nil {
+				json.NewEncoder(w).Encode(decisions)
+				return
+			}
+		case "restore-test":
+			var result *backr.RestoreTestResult
+			result, err = tasks.RunRestoreTest(ctx, name)
+			if err == nil {
+				json.NewEncoder(w).Encode(result)
+				return
+			}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		if err != nil {
+			writeTaskError(w, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	projectRuns := api.authenticate(backr.ScopeStatus, func(w http.ResponseWriter, r *http.Request) {
+
+		parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/projects/"), "/")
+		name := parts[0]
+
+		if len(parts) == 2 {
+			runs, err := tasks.GetRuns(ctx, name)
+			if err != nil {
+				writeTaskError(w, err)
+				return
+			}
+			json.NewEncoder(w).Encode(runs)
+			return
+		}
+
+		id, err := strconv.Atoi(parts[2])
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintln(w, "run id must be a number")
+			return
+		}
+
+		if len(parts) == 4 && parts[3] == "verify" {
+			results, err := tasks.VerifyRun(ctx, name, id)
+			if err != nil {
+				writeTaskError(w, err)
+				return
+			}
+			json.NewEncoder(w).Encode(results)
+			return
+		}
+
+		run, err := tasks.GetRun(ctx, name, id)
+		if err != nil {
+			writeTaskError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(run)
+	})
+
+	runArchive := api.authenticate(backr.ScopeRestore, func(w http.ResponseWriter, r *http.Request) {
+
+		parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/projects/"), "/")
+		name := parts[0]
+
+		id, err := strconv.Atoi(parts[2])
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintln(w, "run id must be a number")
+			return
+		}
+
+		location, err := tasks.GetArchiveLocation(ctx, name, id, r.URL.Query().Get("destination"))
+		if err != nil {
+			writeTaskError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(location)
+	})
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/projects/"), "/")
+
+		switch {
+		case len(parts) < 2 || parts[0] == "":
+			w.WriteHeader(http.StatusNotFound)
+		case parts[1] == "runs" && len(parts) <= 3 && r.Method == http.MethodGet:
+			projectRuns(w, r)
+		case parts[1] == "runs" && len(parts) == 4 && parts[3] == "verify" && r.Method == http.MethodGet:
+			projectRuns(w, r)
+		case parts[1] == "runs" && len(parts) == 4 && parts[3] == "archive" && r.Method == http.MethodGet:
+			runArchive(w, r)
+		case len(parts) == 2 && r.Method == http.MethodPost:
+			projectAction(w, r)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}
+}
+
+// writeTaskError writes an error returned by a task, with the matching HTTP status
+func writeTaskError(w http.ResponseWriter, err error) {
+	if err == tasks.ErrProjectNotFound || err == tasks.ErrRunNotFound || err == tasks.ErrNoArchive || err == tasks.ErrDestinationNotFound || err == tasks.ErrNoRestoreTest {
+		w.WriteHeader(http.StatusNotFound)
+	} else if err == tasks.ErrRestoreTestDryRun {
+		w.WriteHeader(http.StatusConflict)
+	} else {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+	fmt.Fprintln(w, err)
+}
+
+// checkProject ensures the project exists before starting a job, and returns the HTTP status to use otherwise
+func checkProject(ctx context.Context, name string) (int, error) {
+	opts, ok := backr.SettingsFromContext(ctx)
+	if !ok {
+		return http.StatusInternalServerError, fmt.Errorf("Unable to get options from context")
+	}
+
+	stateStorage, err := state.GetStorage(opts)
+	if err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("Unable to connect to state storage: %v", err)
+	}
+
+	project, err := stateStorage.GetProject(ctx, name)
+	if err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("Unable to fetch project from state storage: %v", err)
+	}
+
+	if project == nil {
+		return http.StatusNotFound, fmt.Errorf("Project not found")
+	}
+
+	return http.StatusOK, nil
+}
@@ -0,0 +1,139 @@
+package privatehttp
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"webup/backr"
+	"webup/backr/randstr"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+type tokenKey struct{}
+
+// setupTokens generates the startup token into the token file, and loads the additional tokens
+func setupTokens(settings backr.PrivateAPISettings) ([]backr.APIToken, error) {
+	if settings.TokenFile == "" {
+		return nil, fmt.Errorf("a token file is required to secure the private API")
+	}
+
+	generated := backr.APIToken{
+		Token:  randstr.SecureRandomAlphaString(48),
+		Scopes: backr.AllScopes,
+	}
+
+	if err := os.MkdirAll(filepath.Dir(settings.TokenFile), 0700); err != nil {
+		return nil, fmt.Errorf("unable to create the token file directory: %w", err)
+	}
+	if err := ioutil.WriteFile(settings.TokenFile, []byte(generated.Token+"\n"), 0600); err != nil {
+		return nil, fmt.Errorf("unable to write the token file: %w", err)
+	}
+
+	log.WithField("file", settings.TokenFile).Infoln("Private API token generated")
+
+	tokens := []backr.APIToken{generated}
+
+	if settings.TokensFile != "" {
+		content, err := ioutil.ReadFile(settings.TokensFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read the tokens file: %w", err)
+		}
+
+		additional := []backr.APIToken{}
+		if err := yaml.Unmarshal(content, &additional); err != nil {
+			return nil, fmt.Errorf("unable to parse the tokens file: %w", err)
+		}
+
+		for _, token := range additional {
+			if len(token.Token) < 16 {
+				return nil, fmt.Errorf("tokens must be at least 16 characters long")
+			}
+			for _, scope := range token.Scopes {
+				if !isKnownScope(scope) {
+					return nil, fmt.Errorf("unknown scope '%s'", scope)
+				}
+			}
+		}
+
+		tokens = append(tokens, additional...)
+	}
+
+	return tokens, nil
+}
+
+func isKnownScope(scope backr.APIScope) bool {
+	for _, s := range backr.AllScopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// ReadTokenFile returns the token stored in a token file, as written by the daemon
+func ReadTokenFile(path string) (string, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(content)), nil
+}
+
+// authenticate rejects the requests without a bearer token granting the scope
+func (api *HTTPApi) authenticate(scope backr.APIScope, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		header := r.Header.Get("Authorization")
+		if !strings.HasPrefix(header, "Bearer ") {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprintln(w, "A bearer token is required")
+			return
+		}
+
+		token, ok := api.findToken(strings.TrimPrefix(header, "Bearer "))
+		if !ok {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprintln(w, "Invalid token")
+			return
+		}
+
+		if !token.HasScope(scope) {
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprintf(w, "The '%s' scope is required\n", scope)
+			return
+		}
+
+		next(w, r.WithContext(context.WithValue(r.Context(), tokenKey{}, token)))
+	}
+}
+
+func (api *HTTPApi) findToken(value string) (backr.APIToken, bool) {
+	for _, token := range api.tokens {
+		if subtle.ConstantTimeCompare([]byte(token.Token), []byte(value)) == 1 {
+			return token, true
+		}
+	}
+	return backr.APIToken{}, false
+}
+
+// tokenFromRequest returns the token used to authenticate a request
+func tokenFromRequest(r *http.Request) backr.APIToken {
+	token, _ := r.Context().Value(tokenKey{}).(backr.APIToken)
+	return token
+}
+
+// filterJob hides the download URL of the result if the token doesn't grant the restore scope
+func filterJob(r *http.Request, job backr.Job) backr.Job {
+	if job.Result != nil && !tokenFromRequest(r).HasScope(backr.ScopeRestore) {
+		result := *job.Result
+		result.URL = ""
+		job.Result = &result
+	}
+	return job
+}
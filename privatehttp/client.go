@@ -1,42 +1,301 @@
 package privatehttp
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"net"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 	"webup/backr"
 )
 
 type PrivateAPIClient struct {
-	URL string
+	URL   string
+	Token string
+	http  *http.Client
 }
 
-func NewClient(URL string) backr.PrivateAPIClient {
-	return &PrivateAPIClient{URL: URL}
+// NewClient returns a client of the private API.
+// URL can be a HTTP URL or a unix socket path prefixed with 'unix://'.
+func NewClient(URL string, token string) backr.PrivateAPIClient {
+	client := &PrivateAPIClient{URL: URL, Token: token, http: http.DefaultClient}
+
+	if strings.HasPrefix(URL, "unix://") {
+		socket := strings.TrimPrefix(URL, "unix://")
+		client.URL = "http://unix"
+		client.http = &http.Client{
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+					var dialer net.Dialer
+					return dialer.DialContext(ctx, "unix", socket)
+				},
+			},
+		}
+	}
+
+	return client
+}
+
+func (client *PrivateAPIClient) do(method string, path string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequest(method, client.URL+path, body)
+	if err != nil {
+		return nil, err
+	}
+
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if client.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+client.Token)
+	}
+
+	return client.http.Do(req)
 }
 
-func (client *PrivateAPIClient) Backup(projectName string) (*backr.UploadedArchiveInfo, error) {
+// StartBackup creates a backup job for a project
+func (client *PrivateAPIClient) StartBackup(projectName string) (*backr.Job, error) {
 
-	resp, err := http.Get(client.URL + "/actions/backup?name=" + projectName)
+	body, err := json.Marshal(map[string]string{"project": projectName})
 	if err != nil {
 		return nil, err
 	}
+
+	resp, err := client.do(http.MethodPost, "/jobs", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	return decodeJob(resp, http.StatusAccepted)
+}
+
+// GetJob returns the current state of a job
+func (client *PrivateAPIClient) GetJob(id string) (*backr.Job, error) {
+
+	resp, err := client.do(http.MethodGet, "/jobs/"+id, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	return decodeJob(resp, http.StatusOK)
+}
+
+// CancelJob requests the cancellation of a job
+func (client *PrivateAPIClient) CancelJob(id string) (*backr.Job, error) {
+
+	resp, err := client.do(http.MethodDelete, "/jobs/"+id, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	return decodeJob(resp, http.StatusOK)
+}
+
+// StreamJobLogs copies the archiver output of a job to w, until the job is finished
+func (client *PrivateAPIClient) StreamJobLogs(id string, w io.Writer) error {
+
+	resp, err := client.do(http.MethodGet, "/jobs/"+id+"/logs", nil)
+	if err != nil {
+		return err
+	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != 200 {
-		body, err := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return readError(resp)
+	}
+
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
+
+// PauseProject suspends the scheduled backups of a project. A zero until pauses it indefinitely.
+func (client *PrivateAPIClient) PauseProject(projectName string, until time.Time) error {
+
+	var body io.Reader
+	if !until.IsZero() {
+		data, err := json.Marshal(map[string]time.Time{"until": until})
 		if err != nil {
-			return nil, err
+			return err
 		}
-		return nil, fmt.Errorf("%v", string(body))
+		body = bytes.NewReader(data)
+	}
+
+	return client.projectAction(projectName, "pause", body)
+}
+
+// ResumeProject restores the scheduled backups of a project
+func (client *PrivateAPIClient) ResumeProject(projectName string) error {
+	return client.projectAction(projectName, "resume", nil)
+}
+
+// SkipNextBackup skips the next scheduled backup of a project
+func (client *PrivateAPIClient) SkipNextBackup(projectName string) error {
+	return client.projectAction(projectName, "skip-next", nil)
+}
+
+// Prune applies the retention policy of a project, or only previews it if dryRun is true
+func (client *PrivateAPIClient) Prune(projectName string, dryRun bool) ([]backr.PruneDecision, error) {
+
+	path := "/projects/" + url.PathEscape(projectName) + "/prune"
+	if dryRun {
+		path += "?dry_run=true"
+	}
+
+	resp, err := client.do(http.MethodPost, path, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, readError(resp)
+	}
+
+	decisions := []backr.PruneDecision{}
+	err = json.NewDecoder(resp.Body).Decode(&decisions)
+	if err != nil {
+		return nil, err
+	}
+
+	return decisions, nil
+}
+
+// GetRun returns an execution of a project with its output. A zero id returns the last run.
+func (client *PrivateAPIClient) GetRun(projectName string, id int) (*backr.Run, error) {
+
+	resp, err := client.do(http.MethodGet, "/projects/"+url.PathEscape(projectName)+"/runs/"+strconv.Itoa(id), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, readError(resp)
+	}
+
+	var run backr.Run
+	err = json.NewDecoder(resp.Body).Decode(&run)
+	if err != nil {
+		return nil, err
+	}
+
+	return &run, nil
+}
+
+// VerifyRun checks the availability of the archive of a run on each destination. A zero id verifies the last run.
+func (client *PrivateAPIClient) VerifyRun(projectName string, id int) ([]backr.VerifyResult, error) {
+
+	resp, err := client.do(http.MethodGet, "/projects/"+url.PathEscape(projectName)+"/runs/"+strconv.Itoa(id)+"/verify", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, readError(resp)
+	}
+
+	results := []backr.VerifyResult{}
+	err = json.NewDecoder(resp.Body).Decode(&results)
+	if err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+// RunRestoreTest executes the restore drill of a project, and returns its result
+func (client *PrivateAPIClient) RunRestoreTest(projectName string) (*backr.RestoreTestResult, error) {
+
+	resp, err := client.do(http.MethodPost, "/projects/"+url.PathEscape(projectName)+"/restore-test", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, readError(resp)
+	}
+
+	var result backr.RestoreTestResult
+	err = json.NewDecoder(resp.Body).Decode(&result)
+	if err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+// GetArchiveLocation returns where to download the archive of a run.
+// An empty destination picks the first destination where the archive is available.
+func (client *PrivateAPIClient) GetArchiveLocation(projectName string, id int, destination string) (*backr.ArchiveLocation, error) {
+
+	path := "/projects/" + url.PathEscape(projectName) + "/runs/" + strconv.Itoa(id) + "/archive"
+	if destination != "" {
+		path += "?destination=" + url.QueryEscape(destination)
+	}
+
+	resp, err := client.do(http.MethodGet, path, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, readError(resp)
 	}
 
-	var info backr.UploadedArchiveInfo
-	err = json.NewDecoder(resp.Body).Decode(&info)
+	var location backr.ArchiveLocation
+	err = json.NewDecoder(resp.Body).Decode(&location)
 	if err != nil {
 		return nil, err
 	}
 
-	return &info, nil
+	return &location, nil
+}
+
+func (client *PrivateAPIClient) projectAction(projectName string, action string, body io.Reader) error {
+
+	resp, err := client.do(http.MethodPost, "/projects/"+url.PathEscape(projectName)+"/"+action, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent {
+		return readError(resp)
+	}
+
+	return nil
+}
+
+func decodeJob(resp *http.Response, expectedStatus int) (*backr.Job, error) {
+	if resp.StatusCode != expectedStatus {
+		return nil, readError(resp)
+	}
+
+	var job backr.Job
+	err := json.NewDecoder(resp.Body).Decode(&job)
+	if err != nil {
+		return nil, err
+	}
+
+	return &job, nil
+}
+
+func readError(resp *http.Response) error {
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	return fmt.Errorf("%v", string(bytes.TrimSpace(body)))
 }
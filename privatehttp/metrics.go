@@ -0,0 +1,65 @@
+package privatehttp
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"webup/backr"
+	"webup/backr/tasks"
+)
+
+// labelEscaper escapes the values of the labels in the Prometheus text format
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// Metrics exposes the sizes of the archives in the Prometheus text format, so that the monitoring alerts on the abnormal ones
+func (api *HTTPApi) Metrics(ctx context.Context) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		status, err := tasks.GetStatus(ctx)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintln(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		writeSizeMetrics(w, status)
+	}
+}
+
+// writeSizeMetrics writes the size of the last archive of each project, compared to its baseline
+func writeSizeMetrics(w io.Writer, status backr.Status) {
+	metrics := []struct {
+		name  string
+		help  string
+		value func(size backr.SizeStatus) int64
+	}{
+		{"backr_archive_size_bytes", "Size of the last archive of the project.", func(size backr.SizeStatus) int64 { return size.LastSize }},
+		{"backr_archive_size_baseline_bytes", "Median size of the previous archives of the project (0 without previous archive).", func(size backr.SizeStatus) int64 { return size.Baseline }},
+		{"backr_archive_size_anomaly", "1 if the size of the last archive of the project is abnormal.", func(size backr.SizeStatus) int64 {
+			if size.IsHealthy {
+				return 0
+			}
+			return 1
+		}},
+	}
+
+	for _, metric := range metrics {
+		fmt.Fprintf(w, "# HELP %s %s\n", metric.name, metric.help)
+		fmt.Fprintf(w, "# TYPE %s gauge\n", metric.name)
+
+		for _, project := range status.ConfiguredProjects {
+			if project.Size == nil {
+				continue
+			}
+			fmt.Fprintf(w, "%s{project=\"%s\"} %d\n", metric.name, labelEscaper.Replace(project.Name), metric.value(*project.Size))
+		}
+	}
+}
@@ -1,8 +1,8 @@
 package randstr
 
 import (
+	"crypto/rand"
 	"log"
-	"math/rand"
 )
 
 // From http://stackoverflow.com/a/35615565
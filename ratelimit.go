@@ -0,0 +1,106 @@
+package backr
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RateLimit represents an upload bandwidth limit, optionally depending on the time of day
+type RateLimit struct {
+	// Default is the rate (in bytes per second) applied outside of the rules, 0 means unlimited
+	Default int64
+	Rules   []RateLimitRule
+}
+
+// RateLimitRule applies a rate during a daily window
+type RateLimitRule struct {
+	Window BackupWindow
+	Rate   int64
+}
+
+// ParseRateLimit parses a limit like "5MB" (unlimited if empty or "0"), optionally followed by rules
+// applying during daily windows, like "0,08:00-19:00=5MB" (unlimited at night, 5 MB/s during business hours).
+func ParseRateLimit(value string) (RateLimit, error) {
+	limit := RateLimit{}
+
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		i := strings.Index(item, "=")
+		if i < 0 {
+			rate, err := parseRate(item)
+			if err != nil {
+				return limit, err
+			}
+			limit.Default = rate
+			continue
+		}
+
+		window, err := ParseBackupWindow(item[:i])
+		if err != nil {
+			return limit, err
+		}
+
+		rate, err := parseRate(item[i+1:])
+		if err != nil {
+			return limit, err
+		}
+
+		limit.Rules = append(limit.Rules, RateLimitRule{Window: window, Rate: rate})
+	}
+
+	return limit, nil
+}
+
+// RateAt returns the rate (in bytes per second, 0 means unlimited) applying at the given time.
+// The first matching rule wins.
+func (l RateLimit) RateAt(t time.Time, location *time.Location) int64 {
+	for _, rule := range l.Rules {
+		if rule.Window.Contains(t, location) {
+			return rule.Rate
+		}
+	}
+	return l.Default
+}
+
+// IsUnlimited returns true if the limit never applies
+func (l RateLimit) IsUnlimited() bool {
+	if l.Default != 0 {
+		return false
+	}
+	for _, rule := range l.Rules {
+		if rule.Rate != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// parseRate parses a rate like "512KB", "5MB" or "1GB" (per second, powers of 1024)
+func parseRate(value string) (int64, error) {
+	normalized := strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(value)), "/S")
+	normalized = strings.TrimSuffix(normalized, "B")
+
+	multiplier := int64(1)
+	switch {
+	case strings.HasSuffix(normalized, "K"):
+		multiplier = 1 << 10
+	case strings.HasSuffix(normalized, "M"):
+		multiplier = 1 << 20
+	case strings.HasSuffix(normalized, "G"):
+		multiplier = 1 << 30
+	}
+	normalized = strings.TrimRight(normalized, "KMG")
+
+	number, err := strconv.ParseFloat(normalized, 64)
+	if err != nil || number < 0 {
+		return 0, fmt.Errorf("'%s' is not a valid rate, must be like '5MB'", value)
+	}
+
+	return int64(number * float64(multiplier)), nil
+}
@@ -0,0 +1,59 @@
+package backr
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimitProfiles(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	if err != nil {
+		t.Skipf("time zone database not available: %v", err)
+	}
+
+	at := func(hour, minute int) time.Time {
+		return time.Date(2026, time.June, 15, hour, minute, 0, 0, paris)
+	}
+
+	tests := []struct {
+		name     string
+		value    string
+		time     time.Time
+		expected int64
+	}{
+		{"empty is unlimited", "", at(12, 0), 0},
+		{"constant rate", "5MB", at(12, 0), 5 << 20},
+		{"rule applies inside its window", "0,08:00-19:00=5MB", at(12, 0), 5 << 20},
+		{"rule applies from the start of its window", "0,08:00-19:00=5MB", at(8, 0), 5 << 20},
+		{"default applies outside of the rules", "0,08:00-19:00=5MB", at(20, 0), 0},
+		{"overnight rule applies before midnight", "1MB,22:00-06:00=10MB", at(23, 0), 10 << 20},
+		{"overnight rule applies after midnight", "1MB,22:00-06:00=10MB", at(5, 59), 10 << 20},
+		{"default applies after an overnight rule", "1MB,22:00-06:00=10MB", at(6, 0), 1 << 20},
+		{"first matching rule wins", "0,08:00-19:00=5MB,12:00-14:00=1MB", at(13, 0), 5 << 20},
+		{"later rule applies outside of the first one", "0,08:00-12:00=5MB,12:00-14:00=1MB", at(13, 0), 1 << 20},
+		{"kilobytes", "512KB", at(12, 0), 512 << 10},
+		{"fractional rate per second", "1.5MB/s", at(12, 0), 3 << 19},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			limit, err := ParseRateLimit(test.value)
+			if err != nil {
+				t.Fatalf("ParseRateLimit(%q): %v", test.value, err)
+			}
+
+			if rate := limit.RateAt(test.time, paris); rate != test.expected {
+				t.Errorf("expected %d B/s at %s, got %d", test.expected, test.time.Format("15:04"), rate)
+			}
+		})
+	}
+}
+
+func TestRateLimitInvalid(t *testing.T) {
+	for _, value := range []string{"fast", "-5MB", "08:00-19:00", "25:00-19:00=5MB", "08:00-19:00=fast"} {
+		if _, err := ParseRateLimit(value); err == nil {
+			t.Errorf("ParseRateLimit(%q): expected an error", value)
+		}
+	}
+}
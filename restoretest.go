@@ -0,0 +1,76 @@
+package backr
+
+import (
+	"errors"
+	"time"
+)
+
+// RestoreTestSpec represents a periodic restore drill of the latest archive of a project
+type RestoreTestSpec struct {
+	Every int `yaml:"every"` // days between two drills (default to 7)
+	// Command restores the archive, from the scratch directory. Its environment provides
+	// BACKR_ARCHIVE (the downloaded archive), BACKR_SCRATCH_DIR and BACKR_PROJECT
+	Command []string `yaml:"command"`
+	// Assertions are executed like Command once the archive is restored: the drill fails if one of them fails
+	Assertions [][]string `yaml:"assertions"`
+	// Cleanup is executed like Command at the end of the drill, even if it has failed (to drop a throwaway database...)
+	Cleanup []string `yaml:"cleanup"`
+	Timeout int      `yaml:"timeout"` // in minutes (default to 60)
+}
+
+// RestoreTestResult represents the execution of a restore drill
+type RestoreTestResult struct {
+	StartedAt   time.Time `json:"started_at"`
+	FinishedAt  time.Time `json:"finished_at"`
+	Success     bool      `json:"success"`
+	Error       string    `json:"error,omitempty"`
+	Archive     string    `json:"archive,omitempty"`
+	Destination string    `json:"destination,omitempty"`
+	// Output is the output of the commands (bounded, see MaxRunOutputSize)
+	Output string `json:"output,omitempty"`
+}
+
+// Validate checks the consistency of the spec
+func (r RestoreTestSpec) Validate() error {
+	if len(r.Command) == 0 {
+		return errors.New("'command' is required")
+	}
+
+	if r.Every < 0 || r.Timeout < 0 {
+		return errors.New("'every' and 'timeout' must be positive")
+	}
+
+	for _, assertion := range r.Assertions {
+		if len(assertion) == 0 {
+			return errors.New("'assertions' cannot contain empty commands")
+		}
+	}
+
+	return nil
+}
+
+// Interval returns the duration between two drills
+func (r RestoreTestSpec) Interval() time.Duration {
+	if r.Every == 0 {
+		return 7 * 24 * time.Hour
+	}
+	return time.Duration(r.Every) * 24 * time.Hour
+}
+
+// GetTimeout returns the maximum duration of a drill
+func (r RestoreTestSpec) GetTimeout() time.Duration {
+	if r.Timeout == 0 {
+		return time.Hour
+	}
+	return time.Duration(r.Timeout) * time.Minute
+}
+
+// NextRestoreTest returns the moment when the next drill of the project should be executed.
+// It is zero if there is no drill, or if the first drill is due as soon as possible.
+func (p Project) NextRestoreTest() time.Time {
+	if p.RestoreTest == nil || p.LastRestoreTest == nil {
+		return time.Time{}
+	}
+
+	return p.LastRestoreTest.StartedAt.Add(p.RestoreTest.Interval())
+}
@@ -0,0 +1,126 @@
+package backr
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// RetentionPolicy specifies the archives kept for a project, in a grandfather-father-son fashion.
+// Each keep_* option keeps the most recent archive of the given number of distinct periods.
+type RetentionPolicy struct {
+	KeepLast    int `yaml:"keep_last" json:"keep_last"`
+	KeepHourly  int `yaml:"keep_hourly" json:"keep_hourly"`
+	KeepDaily   int `yaml:"keep_daily" json:"keep_daily"`
+	KeepWeekly  int `yaml:"keep_weekly" json:"keep_weekly"`
+	KeepMonthly int `yaml:"keep_monthly" json:"keep_monthly"`
+	KeepYearly  int `yaml:"keep_yearly" json:"keep_yearly"`
+}
+
+// Archive represents a backup archive stored remotely
+type Archive struct {
+	Name string    `json:"name"`
+	Date time.Time `json:"date"`
+	Size int64     `json:"size"`
+	// Manifest describes the archive, nil if it has none
+	Manifest *ArchiveManifest `json:"manifest,omitempty"`
+}
+
+// PruneDecision tells if an archive is kept by a retention policy, and why
+type PruneDecision struct {
+	Destination string   `json:"destination,omitempty"`
+	Archive     Archive  `json:"archive"`
+	Keep        bool     `json:"keep"`
+	Reasons     []string `json:"reasons,omitempty"`
+	// Deleted tells if the archive not kept has been deleted (false on a dry run)
+	Deleted bool `json:"deleted,omitempty"`
+}
+
+// Validate returns an error if the policy is not valid
+func (p RetentionPolicy) Validate() error {
+	for _, value := range []int{p.KeepLast, p.KeepHourly, p.KeepDaily, p.KeepWeekly, p.KeepMonthly, p.KeepYearly} {
+		if value < 0 {
+			return fmt.Errorf("keep_* values cannot be negative")
+		}
+	}
+
+	if p.IsEmpty() {
+		return fmt.Errorf("at least one keep_* value is required")
+	}
+
+	return nil
+}
+
+// IsEmpty returns true if the policy keeps nothing (and must not be applied)
+func (p RetentionPolicy) IsEmpty() bool {
+	return p.KeepLast+p.KeepHourly+p.KeepDaily+p.KeepWeekly+p.KeepMonthly+p.KeepYearly == 0
+}
+
+type retentionRule struct {
+	name  string
+	count int
+	// period returns the period of a date, archives with the same period are considered as equivalent
+	period func(t time.Time) string
+}
+
+// Plan decides which archives are kept, from the newest to the oldest.
+// Periods (days, weeks...) are computed in the given time zone.
+func (p RetentionPolicy) Plan(archives []Archive, location *time.Location) []PruneDecision {
+	decisions := make([]PruneDecision, len(archives))
+	for i, archive := range archives {
+		decisions[i] = PruneDecision{Archive: archive}
+	}
+
+	// newest first
+	sort.SliceStable(decisions, func(i, j int) bool {
+		return decisions[i].Archive.Date.After(decisions[j].Archive.Date)
+	})
+
+	if p.IsEmpty() {
+		for i := range decisions {
+			decisions[i].Keep = true
+			decisions[i].Reasons = []string{"no retention policy"}
+		}
+		return decisions
+	}
+
+	rules := []retentionRule{
+		{name: "last", count: p.KeepLast, period: func(t time.Time) string { return t.Format(time.RFC3339Nano) }},
+		{name: "hourly", count: p.KeepHourly, period: func(t time.Time) string { return t.Format("2006-01-02 15h") }},
+		{name: "daily", count: p.KeepDaily, period: func(t time.Time) string { return t.Format("2006-01-02") }},
+		{name: "weekly", count: p.KeepWeekly, period: func(t time.Time) string {
+			year, week := t.ISOWeek()
+			return fmt.Sprintf("%d-W%02d", year, week)
+		}},
+		{name: "monthly", count: p.KeepMonthly, period: func(t time.Time) string { return t.Format("2006-01") }},
+		{name: "yearly", count: p.KeepYearly, period: func(t time.Time) string { return t.Format("2006") }},
+	}
+
+	for _, rule := range rules {
+		if rule.count == 0 {
+			continue
+		}
+
+		seen := map[string]bool{}
+		for i := range decisions {
+			if len(seen) == rule.count {
+				break
+			}
+
+			period := rule.period(decisions[i].Archive.Date.In(location))
+			if seen[period] {
+				continue
+			}
+			seen[period] = true
+
+			decisions[i].Keep = true
+			if rule.name == "last" {
+				decisions[i].Reasons = append(decisions[i].Reasons, fmt.Sprintf("last #%d", len(seen)))
+			} else {
+				decisions[i].Reasons = append(decisions[i].Reasons, fmt.Sprintf("%s %s", rule.name, period))
+			}
+		}
+	}
+
+	return decisions
+}
@@ -0,0 +1,71 @@
+package backr
+
+import "time"
+
+// maxRuns is the number of runs kept in the history of a project
+const maxRuns = 10
+
+// Run represents an execution of a backup of a project
+type Run struct {
+	ID         int       `json:"id"`
+	Manual     bool      `json:"manual"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	Success    bool      `json:"success"`
+	Error      string    `json:"error,omitempty"`
+	Archive    string    `json:"archive,omitempty"`
+	// Size is the size of the archive in bytes, and SizeAnomaly tells why it is abnormal (see SizeCheckSpec)
+	Size        int64  `json:"size,omitempty"`
+	SizeAnomaly string `json:"size_anomaly,omitempty"`
+	// Destinations lists where the archive has been uploaded
+	Destinations []DestinationResult `json:"destinations,omitempty"`
+	// Output is the output of the archiver (bounded, see MaxRunOutputSize)
+	Output string `json:"output,omitempty"`
+}
+
+// MaxRunOutputSize is the maximum size of the archiver output kept for a run
+const MaxRunOutputSize = 16 << 10
+
+// AddRun numbers a run and appends it to the history of the project, forgetting the oldest runs
+func (p *Project) AddRun(run Run) Run {
+	run.ID = 1
+	if len(p.Runs) > 0 {
+		run.ID = p.Runs[len(p.Runs)-1].ID + 1
+	}
+
+	p.Runs = append(p.Runs, run)
+	if len(p.Runs) > maxRuns {
+		p.Runs = p.Runs[len(p.Runs)-maxRuns:]
+	}
+
+	return run
+}
+
+// GetRun returns a run of the history. A zero id returns the last run.
+func (p Project) GetRun(id int) (Run, bool) {
+	if len(p.Runs) == 0 {
+		return Run{}, false
+	}
+
+	if id == 0 {
+		return p.Runs[len(p.Runs)-1], true
+	}
+
+	for _, run := range p.Runs {
+		if run.ID == id {
+			return run, true
+		}
+	}
+
+	return Run{}, false
+}
+
+// HasReplica tells if the archive of the run has been uploaded to at least one destination
+func (r Run) HasReplica() bool {
+	for _, destination := range r.Destinations {
+		if destination.Success {
+			return true
+		}
+	}
+	return false
+}
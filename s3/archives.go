@@ -0,0 +1,221 @@
+package s3
+
+import (
+	"context"
+	"fmt"
+	"time"
+	"webup/backr"
+
+	"github.com/minio/minio-go/v6"
+	"github.com/sirupsen/logrus"
+)
+
+// presignedURLExpiry is the validity of the URLs generated to download an archive
+const presignedURLExpiry = 10 * time.Minute
+
+// ProjectPrefix returns the prefix of the objects storing the archives of a project
+func ProjectPrefix(project backr.Project) string {
+	return project.Name + "/"
+}
+
+// ListArchives returns the archives stored for a project, with their manifest if they have one.
+// The date of an archive is the end of its creation, as written in its manifest, or the date of its object.
+func ListArchives(project backr.Project, objects backr.S3ObjectSettings, settings backr.S3Settings) ([]backr.Archive, error) {
+	c, err := getS3Client(settings)
+	if err != nil {
+		return nil, err
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+
+	archives := []backr.Archive{}
+	manifests := map[string]bool{}
+	for object := range c.ListObjectsV2(settings.Bucket, ProjectPrefix(project), true, done) {
+		if object.Err != nil {
+			return nil, fmt.Errorf("unable to list S3 objects: %w", object.Err)
+		}
+
+		if backr.IsManifestName(object.Key) {
+			manifests[object.Key] = true
+			continue
+		}
+
+		archives = append(archives, backr.Archive{
+			Name: object.Key,
+			Date: object.LastModified,
+			Size: object.Size,
+		})
+	}
+
+	for i := range archives {
+		if !manifests[backr.ManifestName(archives[i].Name)] {
+			continue
+		}
+
+		manifest, err := GetManifest(context.Background(), archives[i].Name, objects, settings)
+		if err != nil {
+			// the archive is still listed, as the ones without manifest
+			log.WithFields(logrus.Fields{
+				"bucket": settings.Bucket,
+				"file":   archives[i].Name,
+				"err":    err,
+			}).Warnln("Unable to read the manifest of an archive")
+			continue
+		}
+
+		archives[i].Manifest = manifest
+		if manifest != nil && !manifest.FinishedAt.IsZero() {
+			archives[i].Date = manifest.FinishedAt
+		}
+	}
+
+	return archives, nil
+}
+
+// DeleteArchive removes an archive from the bucket, with its manifest
+func DeleteArchive(name string, settings backr.S3Settings) error {
+	c, err := getS3Client(settings)
+	if err != nil {
+		return err
+	}
+
+	log.WithFields(logrus.Fields{
+		"bucket": settings.Bucket,
+		"file":   name,
+	}).Debugln("Deleting from S3...")
+
+	err = c.RemoveObject(settings.Bucket, name)
+	if err != nil {
+		return fmt.Errorf("unable to delete file from S3: %w", err)
+	}
+
+	// deleting a missing object succeeds: the archives without manifest are deleted as well
+	err = c.RemoveObject(settings.Bucket, backr.ManifestName(name))
+	if err != nil {
+		return fmt.Errorf("unable to delete the manifest from S3: %w", err)
+	}
+
+	return nil
+}
+
+// StatArchive returns the description of an archive stored in the bucket
+func StatArchive(name string, objects backr.S3ObjectSettings, settings backr.S3Settings) (*backr.Archive, error) {
+	c, err := getS3Client(settings)
+	if err != nil {
+		return nil, err
+	}
+
+	opts, err := statOptions(objects)
+	if err != nil {
+		return nil, err
+	}
+
+	object, err := c.StatObject(settings.Bucket, name, opts)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get S3 object: %w", err)
+	}
+
+	return &backr.Archive{
+		Name: object.Key,
+		Date: object.LastModified,
+		Size: object.Size,
+	}, nil
+}
+
+// ArchiveURL returns a presigned URL to download an archive stored in the bucket
+func ArchiveURL(name string, objects backr.S3ObjectSettings, settings backr.S3Settings) (string, error) {
+	if objects.Encryption == backr.EncryptionSSEC {
+		return "", fmt.Errorf("an archive encrypted with a customer key (SSE-C) can not be downloaded with a presigned URL")
+	}
+
+	c, err := getS3Client(settings)
+	if err != nil {
+		return "", err
+	}
+
+	url, err := c.PresignedGetObject(settings.Bucket, name, presignedURLExpiry, nil)
+	if err != nil {
+		return "", fmt.Errorf("unable to generate a presigned URL for a S3 file: %w", err)
+	}
+
+	return url.String(), nil
+}
+
+// CheckObjectLock returns true if Object Lock is enabled on the bucket
+func CheckObjectLock(settings backr.S3Settings) (bool, error) {
+	c, err := getS3Client(settings)
+	if err != nil {
+		return false, err
+	}
+
+	status, _, _, _, err := c.GetObjectLockConfig(settings.Bucket)
+	if err != nil {
+		if isMissingLockConfiguration(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("unable to get the Object Lock configuration: %w", err)
+	}
+
+	return status == "Enabled", nil
+}
+
+// ArchiveLock returns the end of the Object Lock retention of an archive (zero if it is not retained),
+// and whether a legal hold is placed on it
+func ArchiveLock(name string, settings backr.S3Settings) (time.Time, bool, error) {
+	c, err := getS3Client(settings)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+
+	retainUntil := time.Time{}
+	_, until, err := c.GetObjectRetention(settings.Bucket, name, "")
+	if err != nil && !isMissingLockConfiguration(err) {
+		return time.Time{}, false, fmt.Errorf("unable to get the retention of the S3 object: %w", err)
+	}
+	if err == nil && until != nil {
+		retainUntil = *until
+	}
+
+	status, err := c.GetObjectLegalHold(settings.Bucket, name, minio.GetObjectLegalHoldOptions{})
+	if err != nil && !isMissingLockConfiguration(err) {
+		return time.Time{}, false, fmt.Errorf("unable to get the legal hold of the S3 object: %w", err)
+	}
+
+	return retainUntil, err == nil && status != nil && *status == minio.LegalHoldEnabled, nil
+}
+
+// isMissingLockConfiguration returns true if an error means that Object Lock does not apply to the bucket or the object
+func isMissingLockConfiguration(err error) bool {
+	switch minio.ToErrorResponse(err).Code {
+	case "ObjectLockConfigurationNotFoundError", "NoSuchObjectLockConfiguration", "InvalidRequest":
+		return true
+	}
+	return false
+}
+
+// DownloadArchive downloads an archive stored in the bucket into a file
+func DownloadArchive(ctx context.Context, name string, file string, objects backr.S3ObjectSettings, settings backr.S3Settings) error {
+	c, err := getS3Client(settings)
+	if err != nil {
+		return err
+	}
+
+	opts, err := statOptions(objects)
+	if err != nil {
+		return err
+	}
+
+	log.WithFields(logrus.Fields{
+		"destination": settings.Name,
+		"bucket":      settings.Bucket,
+		"file":        name,
+	}).Debugln("Downloading from S3...")
+
+	err = c.FGetObjectWithContext(ctx, settings.Bucket, name, file, minio.GetObjectOptions{ServerSideEncryption: opts.ServerSideEncryption})
+	if err != nil {
+		return fmt.Errorf("unable to download file from S3: %w", err)
+	}
+
+	return nil
+}
@@ -3,16 +3,43 @@ package s3
 import (
 	"fmt"
 	"webup/backr"
+	"webup/backr/logging"
 
 	"github.com/minio/minio-go/v6"
+	"github.com/minio/minio-go/v6/pkg/credentials"
 )
 
+var log = logging.Logger(logging.S3)
+
 func getS3Client(settings backr.S3Settings) (*minio.Client, error) {
+	lookup, err := bucketLookup(settings.BucketLookup)
+	if err != nil {
+		return nil, err
+	}
+
 	// Initialize minio client object.
-	minioClient, err := minio.NewWithRegion(settings.Endpoint, settings.AccessKey, settings.SecretKey, settings.UseTLS, "GRA")
+	minioClient, err := minio.NewWithOptions(settings.Endpoint, &minio.Options{
+		Creds:        credentials.NewStaticV4(settings.AccessKey, settings.SecretKey, ""),
+		Secure:       settings.UseTLS,
+		Region:       settings.Region,
+		BucketLookup: lookup,
+	})
 	if err != nil {
 		return nil, fmt.Errorf("unable to initialize S3 client: %w", err)
 	}
 
 	return minioClient, nil
 }
+
+func bucketLookup(style string) (minio.BucketLookupType, error) {
+	switch style {
+	case "", "auto":
+		return minio.BucketLookupAuto, nil
+	case "dns":
+		return minio.BucketLookupDNS, nil
+	case "path":
+		return minio.BucketLookupPath, nil
+	}
+
+	return minio.BucketLookupAuto, fmt.Errorf("unknown bucket lookup '%s', must be 'auto', 'dns' or 'path'", style)
+}
@@ -0,0 +1,64 @@
+package s3
+
+import (
+	"context"
+	"testing"
+	"webup/backr"
+	"webup/backr/s3/s3test"
+
+	"github.com/minio/minio-go/v6"
+)
+
+func TestClientRegion(t *testing.T) {
+	tests := []struct {
+		name            string
+		region          string
+		expectedRegion  string
+		expectedLocated bool
+	}{
+		{"given region is used", "GRA", "GRA", false},
+		{"empty region is detected from the bucket location", "", "standin-region", true},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			s := s3test.NewStandIn(t)
+			settings := s.Settings()
+			settings.Region = test.region
+
+			client, err := getS3Client(settings)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := putThrottledObject(context.Background(), client, settings.Bucket, "project/archive.tar.gz", writeFile(t, 1024), func() int64 { return 0 }, minio.PutObjectOptions{}); err != nil {
+				t.Fatalf("putThrottledObject: %v", err)
+			}
+
+			regions, located := s.Regions()
+			if located != test.expectedLocated {
+				t.Errorf("expected the bucket location to be requested: %v, got %v", test.expectedLocated, located)
+			}
+			if len(regions) == 0 {
+				t.Fatal("expected signed requests")
+			}
+			for _, region := range regions {
+				if region != test.expectedRegion {
+					t.Errorf("expected requests signed for %q, got %q", test.expectedRegion, region)
+				}
+			}
+		})
+	}
+}
+
+func TestClientBucketLookup(t *testing.T) {
+	for _, style := range []string{"", "auto", "dns", "path"} {
+		if _, err := getS3Client(backr.S3Settings{Endpoint: "127.0.0.1:9000", BucketLookup: style}); err != nil {
+			t.Errorf("bucket lookup %q: %v", style, err)
+		}
+	}
+
+	if _, err := getS3Client(backr.S3Settings{Endpoint: "127.0.0.1:9000", BucketLookup: "virtual"}); err == nil {
+		t.Error("expected an unknown bucket lookup to be refused")
+	}
+}
@@ -0,0 +1,87 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"webup/backr"
+
+	"github.com/minio/minio-go/v6"
+	"github.com/sirupsen/logrus"
+)
+
+// UploadManifest uploads the manifest of an archive next to it, with the same object options
+// (the manifest is encrypted, retained and tagged like its archive)
+func UploadManifest(ctx context.Context, manifest backr.ArchiveManifest, options UploadOptions, settings backr.S3Settings) error {
+	c, err := getS3Client(settings)
+	if err != nil {
+		return err
+	}
+
+	putOpts, err := putOptions(options.Object, options.Tags, options.RetainUntil)
+	if err != nil {
+		return err
+	}
+	putOpts.ContentType = "application/json"
+
+	content, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	name := backr.ManifestName(manifest.Archive)
+	log.WithFields(logrus.Fields{
+		"project":     manifest.Project,
+		"destination": settings.Name,
+		"bucket":      settings.Bucket,
+		"file":        name,
+	}).Debugln("Uploading the manifest to S3...")
+
+	_, err = c.PutObjectWithContext(ctx, settings.Bucket, name, bytes.NewReader(content), int64(len(content)), putOpts)
+	if err != nil {
+		return fmt.Errorf("unable to upload the manifest to S3: %w", err)
+	}
+
+	return nil
+}
+
+// GetManifest returns the manifest stored next to an archive, nil if the archive has none
+// (the archives uploaded by the previous versions of backr)
+func GetManifest(ctx context.Context, archive string, objects backr.S3ObjectSettings, settings backr.S3Settings) (*backr.ArchiveManifest, error) {
+	c, err := getS3Client(settings)
+	if err != nil {
+		return nil, err
+	}
+
+	opts, err := statOptions(objects)
+	if err != nil {
+		return nil, err
+	}
+
+	object, err := c.GetObjectWithContext(ctx, settings.Bucket, backr.ManifestName(archive), minio.GetObjectOptions{ServerSideEncryption: opts.ServerSideEncryption})
+	if err != nil {
+		return nil, fmt.Errorf("unable to get the manifest from S3: %w", err)
+	}
+	defer object.Close()
+
+	content, err := ioutil.ReadAll(object)
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("unable to get the manifest from S3: %w", err)
+	}
+
+	var manifest backr.ArchiveManifest
+	if err := json.Unmarshal(content, &manifest); err != nil {
+		return nil, fmt.Errorf("the manifest of the archive is not valid: %v", err)
+	}
+
+	if manifest.Version > backr.ManifestVersion {
+		return nil, fmt.Errorf("the manifest was written by a newer version of backr (format version %d)", manifest.Version)
+	}
+
+	return &manifest, nil
+}
@@ -0,0 +1,106 @@
+package s3
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"time"
+	"webup/backr"
+
+	"github.com/minio/minio-go/v6"
+	"github.com/minio/minio-go/v6/pkg/encrypt"
+)
+
+// putOptions returns the options of a new object storing an archive
+func putOptions(objects backr.S3ObjectSettings, tags map[string]string, retainUntil time.Time) (minio.PutObjectOptions, error) {
+	sse, err := serverSideEncryption(objects)
+	if err != nil {
+		return minio.PutObjectOptions{}, err
+	}
+
+	opts := minio.PutObjectOptions{
+		ContentType:          objects.ContentType,
+		StorageClass:         objects.StorageClass,
+		ServerSideEncryption: sse,
+		UserTags:             tags,
+	}
+
+	// without retain-until date, the default retention of the bucket applies
+	if objects.LockMode != "" && !retainUntil.IsZero() {
+		mode := minio.Governance
+		if objects.LockMode == backr.LockModeCompliance {
+			mode = minio.Compliance
+		}
+		retainUntil = retainUntil.UTC()
+
+		opts.Mode = &mode
+		opts.RetainUntilDate = &retainUntil
+	}
+
+	if objects.LegalHold {
+		opts.LegalHold = minio.LegalHoldEnabled
+	}
+
+	return opts, nil
+}
+
+// statOptions returns the options needed to read an object storing an archive
+func statOptions(objects backr.S3ObjectSettings) (minio.StatObjectOptions, error) {
+	opts := minio.StatObjectOptions{}
+
+	// only the customer key is needed to read an object, the server manages the other keys
+	if objects.Encryption == backr.EncryptionSSEC {
+		sse, err := serverSideEncryption(objects)
+		if err != nil {
+			return opts, err
+		}
+		opts.ServerSideEncryption = sse
+	}
+
+	return opts, nil
+}
+
+func serverSideEncryption(objects backr.S3ObjectSettings) (encrypt.ServerSide, error) {
+	switch objects.Encryption {
+	case backr.EncryptionSSES3:
+		return encrypt.NewSSE(), nil
+	case backr.EncryptionSSEKMS:
+		sse, err := encrypt.NewSSEKMS(objects.KMSKeyID, nil)
+		if err != nil {
+			return nil, fmt.Errorf("invalid SSE-KMS settings: %w", err)
+		}
+		return sse, nil
+	case backr.EncryptionSSEC:
+		key, err := readCustomerKey(objects.CustomerKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		sse, err := encrypt.NewSSEC(key)
+		if err != nil {
+			return nil, fmt.Errorf("invalid SSE-C key: %w", err)
+		}
+		return sse, nil
+	}
+
+	return nil, nil
+}
+
+// readCustomerKey reads a SSE-C key, stored as 32 raw bytes or encoded in base64
+func readCustomerKey(file string) ([]byte, error) {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the SSE-C key: %w", err)
+	}
+
+	if len(content) == 32 {
+		return content, nil
+	}
+
+	key, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(content)))
+	if err != nil || len(key) != 32 {
+		return nil, fmt.Errorf("the SSE-C key must be 32 bytes long, raw or encoded in base64")
+	}
+
+	return key, nil
+}
@@ -0,0 +1,109 @@
+// Package s3test provides a local HTTP server standing in for a S3 API, to test the uploads without a S3 service:
+//
+//	standIn := s3test.NewStandIn(t)
+//	settings := standIn.Settings()
+package s3test
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"webup/backr"
+)
+
+// StandIn is a local HTTP server standing in for a S3 API: it stores the sizes of the uploaded objects,
+// and records the requests. The location of its buckets is 'standin-region'
+type StandIn struct {
+	server *httptest.Server
+
+	mu       sync.Mutex
+	objects  map[string]int64
+	requests []*http.Request
+}
+
+// NewStandIn starts a stand-in, stopped at the end of the test
+func NewStandIn(t *testing.T) *StandIn {
+	s := &StandIn{objects: map[string]int64{}}
+
+	s.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.requests = append(s.requests, r)
+		s.mu.Unlock()
+
+		// GET /{bucket}?location answers the region of the bucket
+		if r.Method == http.MethodGet {
+			if _, ok := r.URL.Query()["location"]; ok {
+				w.Header().Set("Content-Type", "application/xml")
+				io.WriteString(w, `<?xml version="1.0" encoding="UTF-8"?><LocationConstraint xmlns="http://s3.amazonaws.com/doc/2006-03-01/">standin-region</LocationConstraint>`)
+				return
+			}
+		}
+
+		if r.Method == http.MethodPut {
+			// the payload may be sent in signed chunks: only the decoded length is counted
+			n, _ := io.Copy(ioutil.Discard, r.Body)
+			if length := r.Header.Get("X-Amz-Decoded-Content-Length"); length != "" {
+				n, _ = strconv.ParseInt(length, 10, 64)
+			}
+
+			s.mu.Lock()
+			s.objects[strings.TrimPrefix(r.URL.Path, "/")] = n
+			s.mu.Unlock()
+
+			w.Header().Set("ETag", `"d41d8cd98f00b204e9800998ecf8427e"`)
+			return
+		}
+
+		w.WriteHeader(http.StatusNotImplemented)
+	}))
+	t.Cleanup(s.server.Close)
+
+	return s
+}
+
+// Settings returns the settings of a destination using the stand-in, whose bucket is 'bucket'
+func (s *StandIn) Settings() backr.S3Settings {
+	return backr.S3Settings{
+		Name:         "standin",
+		Bucket:       "bucket",
+		Endpoint:     strings.TrimPrefix(s.server.URL, "http://"),
+		AccessKey:    "access",
+		SecretKey:    "secretsecret",
+		BucketLookup: "path",
+	}
+}
+
+// Object returns the size of an uploaded object, named like 'bucket/key'
+func (s *StandIn) Object(name string) (int64, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	size, ok := s.objects[name]
+	return size, ok
+}
+
+// Regions returns the regions in the signatures of the requests, and whether the bucket location was requested
+func (s *StandIn) Regions() ([]string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	regions := []string{}
+	located := false
+	for _, r := range s.requests {
+		if _, ok := r.URL.Query()["location"]; ok {
+			located = true
+			continue
+		}
+
+		// like 'AWS4-HMAC-SHA256 Credential=access/20260101/us-east-1/s3/aws4_request, ...'
+		if parts := strings.Split(r.Header.Get("Authorization"), "/"); len(parts) > 2 {
+			regions = append(regions, parts[2])
+		}
+	}
+	return regions, located
+}
@@ -1,49 +1,92 @@
 package s3
 
 import (
+	"context"
 	"fmt"
+	"os"
 	"time"
 	"webup/backr"
+	"webup/backr/throttle"
 
 	"github.com/minio/minio-go/v6"
-	log "github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus"
 )
 
-// Upload is responsible to upload a backup file to a S3 storage
-func Upload(project backr.Project, backup backr.Backup, file string, fileExt string, returnBackupURL bool, settings backr.S3Settings) (*backr.UploadedArchiveInfo, error) {
+// ObjectName returns the name of the object storing an archive of a backup created at the given time,
+// named by the template of the project or of the settings
+func ObjectName(project backr.Project, backup backr.Backup, fileExt string, t time.Time, settings backr.Settings) (string, error) {
+	name, err := backr.RenderArchiveName(project.GetArchiveNameTemplate(settings), backr.NewArchiveNameData(project, backup, t))
+	if err != nil {
+		return "", fmt.Errorf("unable to name the archive: %v", err)
+	}
+
+	return fmt.Sprintf("%s%s.%s", ProjectPrefix(project), name, fileExt), nil
+}
+
+// UploadOptions customizes an upload
+type UploadOptions struct {
+	// ReturnBackupURL generates a presigned URL for the uploaded archive
+	ReturnBackupURL bool
+	// Rate returns the allowed bytes per second during the upload (nil or 0 means unlimited)
+	Rate func() int64
+	// Object are the options of the object storing the archive
+	Object backr.S3ObjectSettings
+	// Tags are added to the object
+	Tags map[string]string
+	// RetainUntil is the end of the Object Lock retention, if Object.LockMode is set
+	RetainUntil time.Time
+}
+
+// Upload is responsible to upload a backup file to a S3 storage, as the object filename.
+func Upload(ctx context.Context, project backr.Project, filename string, file string, options UploadOptions, settings backr.S3Settings) (*backr.UploadedArchiveInfo, error) {
 	c, err := getS3Client(settings)
 	if err != nil {
 		return nil, err
 	}
 
-	filename := fmt.Sprintf("%s/%s.%s", project.Name, time.Now().Format(time.RFC3339), fileExt)
+	putOpts, err := putOptions(options.Object, options.Tags, options.RetainUntil)
+	if err != nil {
+		return nil, err
+	}
 
 	info := backr.UploadedArchiveInfo{
 		Name: filename,
 	}
 
-	log.WithFields(log.Fields{
-		"bucket": settings.Bucket,
-		"file":   filename,
+	log.WithFields(logrus.Fields{
+		"project":     project.Name,
+		"destination": settings.Name,
+		"bucket":      settings.Bucket,
+		"file":        filename,
 	}).Debugln("Uploading to S3...")
 
-	n, err := c.FPutObject(settings.Bucket, filename, file, minio.PutObjectOptions{})
+	var n int64
+	if options.Rate == nil {
+		n, err = c.FPutObjectWithContext(ctx, settings.Bucket, filename, file, putOpts)
+	} else {
+		n, err = putThrottledObject(ctx, c, settings.Bucket, filename, file, options.Rate, putOpts)
+	}
 	if err != nil {
 		return &info, fmt.Errorf("unable to upload file to S3: %w", err)
 	}
 
-	log.WithFields(log.Fields{
-		"bucket": settings.Bucket,
-		"file":   filename,
-		"size":   n,
+	log.WithFields(logrus.Fields{
+		"project":     project.Name,
+		"destination": settings.Name,
+		"bucket":      settings.Bucket,
+		"file":        filename,
+		"size":        n,
 	}).Debugln("file successfully uploaded to S3")
 
-	if returnBackupURL {
-		url, err := c.PresignedGetObject(settings.Bucket, filename, 10*time.Minute, nil)
+	// a presigned URL can not provide the customer key needed to read the object
+	if options.ReturnBackupURL && options.Object.Encryption != backr.EncryptionSSEC {
+		url, err := c.PresignedGetObject(settings.Bucket, filename, presignedURLExpiry, nil)
 		if err != nil {
-			log.WithFields(log.Fields{
-				"bucket": settings.Bucket,
-				"file":   filename,
+			log.WithFields(logrus.Fields{
+				"project":     project.Name,
+				"destination": settings.Name,
+				"bucket":      settings.Bucket,
+				"file":        filename,
 			}).Debugln("unable to generate a presigned URL for a S3 file")
 		} else {
 			info.URL = url.String()
@@ -52,3 +95,21 @@ func Upload(project backr.Project, backup backr.Backup, file string, fileExt str
 
 	return &info, nil
 }
+
+// putThrottledObject uploads a file, limiting the bandwidth
+func putThrottledObject(ctx context.Context, c *minio.Client, bucket string, name string, file string, rate func() int64, opts minio.PutObjectOptions) (int64, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	stat, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	reader := throttle.NewReader(ctx, f, rate)
+
+	return c.PutObjectWithContext(ctx, bucket, name, reader, stat.Size(), opts)
+}
@@ -0,0 +1,76 @@
+package s3
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+	"webup/backr"
+	"webup/backr/s3/s3test"
+)
+
+// writeFile writes a temporary file of the given size
+func writeFile(t *testing.T, size int) string {
+	file := filepath.Join(t.TempDir(), "archive.tar.gz")
+	if err := ioutil.WriteFile(file, make([]byte, size), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+// uploadFile uploads a file of the given size to the stand-in, and returns the duration of the upload
+func uploadFile(t *testing.T, s *s3test.StandIn, size int, rate func() int64) time.Duration {
+	file := writeFile(t, size)
+
+	settings := s.Settings()
+	settings.Region = "us-east-1"
+
+	start := time.Now()
+	_, err := Upload(context.Background(), backr.Project{Name: "project"}, "project/archive.tar.gz", file, UploadOptions{Rate: rate}, settings)
+	elapsed := time.Since(start)
+	if err != nil {
+		t.Fatalf("Upload: %v", err)
+	}
+
+	if received, ok := s.Object("bucket/project/archive.tar.gz"); !ok || received != int64(size) {
+		t.Errorf("expected an object of %d bytes, got %d", size, received)
+	}
+
+	return elapsed
+}
+
+func TestUploadThrottled(t *testing.T) {
+	const rate = 256 << 10
+
+	elapsed := uploadFile(t, s3test.NewStandIn(t), rate*3/2, func() int64 { return rate })
+	if elapsed < 1400*time.Millisecond || elapsed > 2500*time.Millisecond {
+		t.Errorf("expected about 1.5s at %d B/s, took %v", rate, elapsed)
+	}
+}
+
+func TestUploadUnlimited(t *testing.T) {
+	elapsed := uploadFile(t, s3test.NewStandIn(t), 4<<20, nil)
+	if elapsed > time.Second {
+		t.Errorf("expected an unlimited upload, took %v", elapsed)
+	}
+}
+
+func TestUploadFollowsRateProfile(t *testing.T) {
+	const rate = 64 << 10
+
+	// the upload starts one second before the end of the limited window, then continues unlimited
+	limit, err := backr.ParseRateLimit("0,07:00-08:00=64KB")
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock := time.Date(2026, time.June, 15, 7, 59, 59, 0, time.UTC)
+	start := time.Now()
+
+	elapsed := uploadFile(t, s3test.NewStandIn(t), rate*10, func() int64 {
+		return limit.RateAt(clock.Add(time.Since(start)), time.UTC)
+	})
+	if elapsed < 900*time.Millisecond || elapsed > 3*time.Second {
+		t.Errorf("expected about 1s (limited until 08:00, then unlimited), took %v", elapsed)
+	}
+}
@@ -0,0 +1,122 @@
+package backr
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Server-side encryption modes of the S3 objects
+const (
+	EncryptionSSES3  = "sse-s3"
+	EncryptionSSEKMS = "sse-kms"
+	EncryptionSSEC   = "sse-c"
+)
+
+// Object Lock retention modes of the S3 objects
+const (
+	LockModeGovernance = "governance"
+	LockModeCompliance = "compliance"
+)
+
+// S3ObjectSettings represents the options of the S3 objects storing the archives
+type S3ObjectSettings struct {
+	StorageClass string `yaml:"storage_class"` // like 'STANDARD_IA', the bucket default is used if empty
+	ContentType  string `yaml:"content_type"`
+	// Encryption is the server-side encryption: 'sse-s3', 'sse-kms' (with KMSKeyID) or 'sse-c' (with CustomerKeyFile)
+	Encryption      string `yaml:"encryption"`
+	KMSKeyID        string `yaml:"kms_key_id"`
+	CustomerKeyFile string `yaml:"customer_key_file"` // file containing the 32 bytes key (raw or base64) used by 'sse-c'
+	// Tagging adds the project, backup and host tags to the objects
+	Tagging bool              `yaml:"tagging"`
+	Tags    map[string]string `yaml:"tags"`
+	// LockMode enables Object Lock: 'governance' or 'compliance'. Objects are retained during the TTL of their backup
+	LockMode  string `yaml:"lock_mode"`
+	LegalHold bool   `yaml:"legal_hold"`
+}
+
+// IsLocked returns true if the objects are protected by Object Lock
+func (o S3ObjectSettings) IsLocked() bool {
+	return o.LockMode != "" || o.LegalHold
+}
+
+// Validate checks the consistency of the settings
+func (o S3ObjectSettings) Validate() error {
+	switch o.Encryption {
+	case "", EncryptionSSES3:
+	case EncryptionSSEKMS:
+		if o.KMSKeyID == "" {
+			return errors.New("'kms_key_id' is required by 'sse-kms' encryption")
+		}
+	case EncryptionSSEC:
+		if o.CustomerKeyFile == "" {
+			return errors.New("'customer_key_file' is required by 'sse-c' encryption")
+		}
+	default:
+		return fmt.Errorf("unknown encryption '%s', must be 'sse-s3', 'sse-kms' or 'sse-c'", o.Encryption)
+	}
+
+	if o.KMSKeyID != "" && o.Encryption != EncryptionSSEKMS {
+		return errors.New("'kms_key_id' requires 'sse-kms' encryption")
+	}
+
+	if o.CustomerKeyFile != "" && o.Encryption != EncryptionSSEC {
+		return errors.New("'customer_key_file' requires 'sse-c' encryption")
+	}
+
+	if o.LockMode != "" && o.LockMode != LockModeGovernance && o.LockMode != LockModeCompliance {
+		return fmt.Errorf("unknown lock mode '%s', must be 'governance' or 'compliance'", o.LockMode)
+	}
+
+	return nil
+}
+
+// Merge returns the settings overridden by the non-empty values of another settings
+func (o S3ObjectSettings) Merge(override S3ObjectSettings) S3ObjectSettings {
+	merged := o
+
+	if override.StorageClass != "" {
+		merged.StorageClass = override.StorageClass
+	}
+	if override.ContentType != "" {
+		merged.ContentType = override.ContentType
+	}
+	if override.Encryption != "" {
+		merged.Encryption = override.Encryption
+		merged.KMSKeyID = override.KMSKeyID
+		merged.CustomerKeyFile = override.CustomerKeyFile
+	}
+	if override.LockMode != "" {
+		merged.LockMode = override.LockMode
+	}
+	merged.Tagging = o.Tagging || override.Tagging
+	merged.LegalHold = o.LegalHold || override.LegalHold
+
+	merged.Tags = map[string]string{}
+	for key, value := range o.Tags {
+		merged.Tags[key] = value
+	}
+	for key, value := range override.Tags {
+		merged.Tags[key] = value
+	}
+
+	return merged
+}
+
+// ParseTags parses a list of tags like 'env=prod,team=web'
+func ParseTags(value string) (map[string]string, error) {
+	tags := map[string]string{}
+	if value == "" {
+		return tags, nil
+	}
+
+	for _, tag := range strings.Split(value, ",") {
+		parts := strings.SplitN(tag, "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+			return nil, fmt.Errorf("tag '%s' must be like 'key=value'", tag)
+		}
+		tags[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+	}
+
+	return tags, nil
+}
@@ -2,12 +2,17 @@ package backr
 
 import (
 	"context"
+	"os"
+	"sync/atomic"
 	"time"
 )
 
 type key int
 
-const settingsKey key = 0
+const (
+	settingsKey key = iota
+	shutdownKey
+)
 
 // Settings represents the settings that can be configured with CLI
 type Settings struct {
@@ -22,27 +27,128 @@ type Settings struct {
 	ApiListen        string
 	PrivateAPIListen string
 	SecretFilepath   string
+	PrivateAPI       PrivateAPISettings
+	// DryRun disables the execution of backups and the updates of the state
+	DryRun bool
+	// UploadRateLimit limits the bandwidth used to upload archives, unless a project overrides it
+	UploadRateLimit RateLimit
+	// ArchiveNameTemplate names the archives, unless a project overrides it (see DefaultArchiveNameTemplate)
+	ArchiveNameTemplate string
+	// S3Objects are the options of the objects storing the archives, unless a project overrides them
+	S3Objects S3ObjectSettings
+	// Replicas are the S3 destinations receiving a copy of each archive, in addition to S3
+	Replicas          []S3Settings
+	ReplicationPolicy ReplicationPolicy
+	// ShutdownGracePeriod is how long the daemon waits for the running backups when it is stopped, before cancelling them
+	ShutdownGracePeriod time.Duration
+	// ProjectNamespace prefixes the names of the projects found in the watched directories, to avoid collisions
+	ProjectNamespace ProjectNamespace
+}
+
+// GetDestinations returns the S3 destinations receiving the archives, the main one first
+func (s Settings) GetDestinations() []S3Settings {
+	if s.S3 == nil {
+		return nil
+	}
+
+	main := *s.S3
+	if main.Name == "" {
+		main.Name = DefaultDestinationName
+	}
+
+	return append([]S3Settings{main}, s.Replicas...)
+}
+
+// GetDestination returns a destination by its name
+func (s Settings) GetDestination(name string) (S3Settings, bool) {
+	for _, destination := range s.GetDestinations() {
+		if destination.Name == name {
+			return destination, true
+		}
+	}
+	return S3Settings{}, false
+}
+
+// PrivateAPISettings represents the settings of the private API, in addition to PrivateAPIListen
+type PrivateAPISettings struct {
+	// Socket is the path of an optional unix socket to listen on
+	Socket     string
+	SocketMode os.FileMode
+	// TokenFile is where the token generated at startup (granting every scope) is written
+	TokenFile string
+	// TokensFile is an optional YAML file listing additional tokens with their scopes
+	TokensFile string
 }
 
 // S3Settings represents the settings needed to use S3 API
 type S3Settings struct {
-	Bucket    string
-	Endpoint  string
-	AccessKey string
-	SecretKey string
-	UseTLS    bool
+	// Name identifies the destination when archives are replicated
+	Name      string `yaml:"name"`
+	Bucket    string `yaml:"bucket"`
+	Endpoint  string `yaml:"endpoint"`
+	AccessKey string `yaml:"access_key"`
+	SecretKey string `yaml:"secret_key"`
+	UseTLS    bool   `yaml:"use_tls"`
+	// Region is detected from the bucket location if empty
+	Region string `yaml:"region"`
+	// BucketLookup is the style of the bucket URLs: 'auto', 'dns' (virtual-host) or 'path'
+	BucketLookup string `yaml:"bucket_lookup"`
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler: like the default destination, TLS is used unless use_tls is false
+func (s *S3Settings) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain S3Settings
+	settings := plain{UseTLS: true}
+	if err := unmarshal(&settings); err != nil {
+		return err
+	}
+
+	*s = S3Settings(settings)
+	return nil
 }
 
+// ProjectNamespace tells how the names of the projects are prefixed
+type ProjectNamespace string
+
+const (
+	// NamespaceNone keeps the names of the backup.yml files
+	NamespaceNone ProjectNamespace = ""
+	// NamespaceWatchDir prefixes the names with the base name of the watched directory, like 'apps.toto'
+	NamespaceWatchDir ProjectNamespace = "watch-dir"
+	// NamespaceHostname prefixes the names with the short host name, like 'web1.toto'.
+	// It only separates the projects of several hosts sharing a state storage or a bucket, not the projects of a host
+	NamespaceHostname ProjectNamespace = "hostname"
+)
+
+// DefaultDestinationName is the name of the main S3 destination, if it is not named
+const DefaultDestinationName = "default"
+
+// ReplicationPolicy tells how a backup uploaded to only some of the destinations is considered
+type ReplicationPolicy string
+
+const (
+	// ReplicationRequireAll considers a backup failed if an upload has failed
+	ReplicationRequireAll ReplicationPolicy = "all"
+	// ReplicationRequireOne considers a backup successful if at least one upload has succeeded
+	ReplicationRequireOne ReplicationPolicy = "any"
+)
+
 type StateStorageType string
 
 const (
-	StateStorageEtcd  StateStorageType = "etcd"
-	StateStorageLocal StateStorageType = "local"
+	StateStorageEtcd   StateStorageType = "etcd"
+	StateStorageLocal  StateStorageType = "local"
+	StateStorageSQL    StateStorageType = "sql"
+	StateStorageMemory StateStorageType = "memory"
 )
 
 type StateStorageSettings struct {
 	EtcdEndpoints *string
 	LocalPath     *string
+	// SQL is the data source of a SQL database, like 'sqlite:///var/lib/backr/state.db' or 'postgres://host/backr'
+	SQL *string
+	// Memory keeps the state in memory only, for ephemeral runs
+	Memory bool
 }
 
 func (st *StateStorageSettings) GetType() StateStorageType {
@@ -50,6 +156,14 @@ func (st *StateStorageSettings) GetType() StateStorageType {
 		return StateStorageLocal
 	}
 
+	if st.SQL != nil && *st.SQL != "" {
+		return StateStorageSQL
+	}
+
+	if st.Memory {
+		return StateStorageMemory
+	}
+
 	return StateStorageEtcd
 }
 
@@ -58,6 +172,18 @@ type BackupTimeSpec struct {
 	Hour   int
 	Minute int
 	Period time.Duration
+	// Location is the time zone of Hour and Minute (nil means the local time zone)
+	Location *time.Location
+	// Window replaces the start hour when it is set
+	Window *BackupWindow
+}
+
+// GetLocation returns the time zone of the spec
+func (ts BackupTimeSpec) GetLocation() *time.Location {
+	if ts.Location == nil {
+		return time.Local
+	}
+	return ts.Location
 }
 
 // NewDefaultSettings returns default options
@@ -70,9 +196,14 @@ func NewDefaultSettings() Settings {
 			Minute: 0,
 			Period: time.Duration(24) * time.Hour, // unit of 1 day for ttl and minAge (WARNING: cannot be less (scheduling issues))
 		},
-		StartupTime:      time.Now(),
-		ApiListen:        ":22257",
-		PrivateAPIListen: "127.0.0.1:22258",
+		StartupTime:         time.Now(),
+		ReplicationPolicy:   ReplicationRequireAll,
+		ShutdownGracePeriod: 10 * time.Minute,
+		ApiListen:           ":22257",
+		PrivateAPIListen:    "127.0.0.1:22258",
+		PrivateAPI: PrivateAPISettings{
+			SocketMode: 0660,
+		},
 	}
 }
 
@@ -81,8 +212,49 @@ func NewContextWithSettings(ctx context.Context, settings Settings) context.Cont
 	return context.WithValue(ctx, settingsKey, settings)
 }
 
+// NewContextWithReloadableSettings returns a context with associated options, which can be replaced by calling
+// the returned function. Use NewContextWithSettings to keep the current options during a long operation.
+func NewContextWithReloadableSettings(ctx context.Context, settings Settings) (context.Context, func(Settings)) {
+	holder := &settingsHolder{}
+	holder.value.Store(settings)
+
+	return context.WithValue(ctx, settingsKey, holder), func(settings Settings) {
+		holder.value.Store(settings)
+	}
+}
+
+type settingsHolder struct {
+	value atomic.Value
+}
+
 // SettingsFromContext returns the options associated to a context
 func SettingsFromContext(ctx context.Context) (Settings, bool) {
-	options, ok := ctx.Value(settingsKey).(Settings)
-	return options, ok
+	switch options := ctx.Value(settingsKey).(type) {
+	case Settings:
+		return options, true
+	case *settingsHolder:
+		return options.value.Load().(Settings), true
+	}
+	return Settings{}, false
+}
+
+// NewContextWithShutdown returns a context reporting that the process is stopping once stopping is closed.
+// Unlike a cancellation, it does not interrupt the running operations: they only avoid starting new ones.
+func NewContextWithShutdown(ctx context.Context, stopping <-chan struct{}) context.Context {
+	return context.WithValue(ctx, shutdownKey, stopping)
+}
+
+// ShuttingDown returns true if the process associated to a context is stopping
+func ShuttingDown(ctx context.Context) bool {
+	stopping, ok := ctx.Value(shutdownKey).(<-chan struct{})
+	if !ok {
+		return false
+	}
+
+	select {
+	case <-stopping:
+		return true
+	default:
+		return false
+	}
 }
@@ -0,0 +1,34 @@
+package backr
+
+import (
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestS3SettingsUseTLSByDefault(t *testing.T) {
+	content := `
+- name: tls-omitted
+  bucket: backups
+  endpoint: s3.example.com
+- name: tls-disabled
+  bucket: backups
+  endpoint: minio.local:9000
+  use_tls: false
+`
+
+	replicas := []S3Settings{}
+	if err := yaml.Unmarshal([]byte(content), &replicas); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(replicas) != 2 {
+		t.Fatalf("expected 2 replicas, got %d", len(replicas))
+	}
+	if !replicas[0].UseTLS || replicas[0].Bucket != "backups" {
+		t.Errorf("expected TLS when use_tls is omitted, got %+v", replicas[0])
+	}
+	if replicas[1].UseTLS {
+		t.Errorf("expected no TLS when use_tls is false, got %+v", replicas[1])
+	}
+}
@@ -0,0 +1,133 @@
+package backr
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// SizeCheckSpec detects the archives whose size is abnormal. An archive much smaller than the previous ones
+// usually means that the archiver did not find its data (empty database, wrong directory...)
+type SizeCheckSpec struct {
+	// MinSize is the size under which an archive is always abnormal, like "10MB"
+	MinSize string `yaml:"min_size"`
+	// MaxDecrease and MaxIncrease are the deviations from the baseline (in percent) from which an archive is abnormal, 0 to disable them
+	MaxDecrease int `yaml:"max_decrease"`
+	MaxIncrease int `yaml:"max_increase"`
+	// Baseline is the number of previous runs whose median archive size is the baseline (default to 5)
+	Baseline int `yaml:"baseline"`
+	// Action is 'warn' (default) to report the abnormal archives, or 'fail' to consider their backups as failed
+	Action string `yaml:"action"`
+}
+
+const (
+	SizeCheckWarn = "warn"
+	SizeCheckFail = "fail"
+)
+
+// DefaultSizeCheck applies to the projects without size check: the archives shrinking by more than a half are reported
+var DefaultSizeCheck = SizeCheckSpec{MaxDecrease: 50}
+
+// Validate checks the consistency of the spec
+func (s SizeCheckSpec) Validate() error {
+	if s.MinSize != "" {
+		if _, err := parseRate(s.MinSize); err != nil {
+			return fmt.Errorf("'min_size' is not valid: %v", err)
+		}
+	}
+
+	if s.MaxDecrease < 0 || s.MaxDecrease > 100 || s.MaxIncrease < 0 {
+		return errors.New("'max_decrease' must be between 0 and 100, and 'max_increase' must be positive")
+	}
+
+	if s.Baseline < 0 || s.Baseline > maxRuns {
+		return fmt.Errorf("'baseline' must be positive, and %d at most (the runs kept in the history)", maxRuns)
+	}
+
+	if s.Action != "" && s.Action != SizeCheckWarn && s.Action != SizeCheckFail {
+		return errors.New("'action' must be 'warn' or 'fail'")
+	}
+
+	return nil
+}
+
+// Fails tells if the backups producing an abnormal archive are failed
+func (s SizeCheckSpec) Fails() bool {
+	return s.Action == SizeCheckFail
+}
+
+// Check returns why the size of a new archive is abnormal compared to the previous runs, or an empty string
+func (s SizeCheckSpec) Check(size int64, previous []Run) string {
+	if s.MinSize != "" {
+		// the minimum is validated when parsing the spec
+		if minSize, _ := parseRate(s.MinSize); size < minSize {
+			return fmt.Sprintf("archive size %s is under the minimum of %s", FormatSize(size), FormatSize(minSize))
+		}
+	}
+
+	baseline := s.BaselineSize(previous)
+	if baseline == 0 {
+		return ""
+	}
+
+	deviation := float64(size-baseline) * 100 / float64(baseline)
+	if s.MaxDecrease > 0 && -deviation > float64(s.MaxDecrease) {
+		return fmt.Sprintf("archive size %s is %.0f%% under the baseline of %s", FormatSize(size), -deviation, FormatSize(baseline))
+	}
+	if s.MaxIncrease > 0 && deviation > float64(s.MaxIncrease) {
+		return fmt.Sprintf("archive size %s is %.0f%% over the baseline of %s", FormatSize(size), deviation, FormatSize(baseline))
+	}
+
+	return ""
+}
+
+// BaselineSize returns the median size of the archives of the last successful runs, 0 if no run has produced an archive.
+// The abnormal archives are left out, so that repeated anomalies never become the baseline: a legitimate change
+// of size is reported until the thresholds are adjusted.
+func (s SizeCheckSpec) BaselineSize(runs []Run) int64 {
+	count := s.Baseline
+	if count == 0 {
+		count = 5
+	}
+
+	sizes := []int64{}
+	for i := len(runs) - 1; i >= 0 && len(sizes) < count; i-- {
+		if runs[i].Size > 0 && runs[i].Success && runs[i].SizeAnomaly == "" {
+			sizes = append(sizes, runs[i].Size)
+		}
+	}
+	if len(sizes) == 0 {
+		return 0
+	}
+
+	sort.Slice(sizes, func(i, j int) bool { return sizes[i] < sizes[j] })
+	if len(sizes)%2 == 0 {
+		return (sizes[len(sizes)/2-1] + sizes[len(sizes)/2]) / 2
+	}
+	return sizes[len(sizes)/2]
+}
+
+// GetSizeCheck returns the size check of the project, or the default one
+func (p Project) GetSizeCheck() SizeCheckSpec {
+	if p.SizeCheck != nil {
+		return *p.SizeCheck
+	}
+	return DefaultSizeCheck
+}
+
+// FormatSize formats a size in bytes, like "4.2 GB" (powers of 1024)
+func FormatSize(size int64) string {
+	units := []string{"B", "KB", "MB", "GB", "TB"}
+
+	value := float64(size)
+	unit := 0
+	for value >= 1024 && unit < len(units)-1 {
+		value /= 1024
+		unit++
+	}
+
+	if unit == 0 {
+		return fmt.Sprintf("%d B", size)
+	}
+	return fmt.Sprintf("%.1f %s", value, units[unit])
+}
@@ -0,0 +1,165 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"time"
+	"webup/backr"
+	"webup/backr/randstr"
+)
+
+// Acquire takes the lease of name for ttl. If another valid lease exists, it is returned with ErrLeaseHeld (Locker interface)
+func (s *Storage) Acquire(ctx context.Context, name string, holder string, ttl time.Duration) (backr.Lease, error) {
+	now := time.Now()
+	lease := backr.Lease{
+		Name:       name,
+		Holder:     holder,
+		Token:      randstr.SecureRandomAlphaString(16),
+		AcquiredAt: now,
+		ExpiresAt:  now.Add(ttl),
+	}
+
+	var held backr.Lease
+	err := s.transaction(ctx, func(tx *sql.Tx) error {
+		current, ok, err := s.getLease(ctx, tx, name)
+		if err != nil {
+			return err
+		}
+		if ok && current.IsValid(now) {
+			held = current
+			return backr.ErrLeaseHeld
+		}
+
+		if !ok {
+			_, err := tx.ExecContext(ctx, s.rebind("INSERT INTO leases (name, holder, token, acquired_at, expires_at) VALUES (?, ?, ?, ?, ?)"),
+				lease.Name, lease.Holder, lease.Token, encodeTime(lease.AcquiredAt), encodeTime(lease.ExpiresAt))
+			return err
+		}
+
+		// the expired lease is only replaced if nobody else did it meanwhile
+		return s.updateLease(ctx, tx, lease, current.Token, backr.ErrLeaseHeld)
+	})
+	if err == backr.ErrLeaseHeld && held.Name != "" {
+		return held, err
+	}
+	if err != nil {
+		// another instance may have written the lease concurrently
+		current, ok, readErr := s.getLease(ctx, nil, name)
+		if readErr == nil && ok && current.IsValid(time.Now()) {
+			return current, backr.ErrLeaseHeld
+		}
+		return backr.Lease{}, err
+	}
+
+	log.WithField("lease", name).Debugln("Lease acquired.")
+
+	return lease, nil
+}
+
+// Renew extends a lease for ttl, returning ErrLeaseLost if it is not owned anymore (Locker interface)
+func (s *Storage) Renew(ctx context.Context, lease backr.Lease, ttl time.Duration) (backr.Lease, error) {
+	// an expired lease is still owned, as long as nobody else acquired it
+	lease.ExpiresAt = time.Now().Add(ttl)
+
+	err := s.transaction(ctx, func(tx *sql.Tx) error {
+		return s.updateLease(ctx, tx, lease, lease.Token, backr.ErrLeaseLost)
+	})
+
+	return lease, err
+}
+
+// Release gives up a lease, if it is still owned (Locker interface)
+func (s *Storage) Release(ctx context.Context, lease backr.Lease) error {
+	result, err := db.ExecContext(ctx, s.rebind("DELETE FROM leases WHERE name = ? AND token = ?"), lease.Name, lease.Token)
+	if err != nil {
+		return err
+	}
+
+	if n, err := result.RowsAffected(); err == nil && n > 0 {
+		log.WithField("lease", lease.Name).Debugln("Lease released.")
+	}
+
+	return nil
+}
+
+// Leases returns the valid leases, by name (Locker interface)
+func (s *Storage) Leases(ctx context.Context) (map[string]backr.Lease, error) {
+	now := time.Now()
+	leases := map[string]backr.Lease{}
+
+	rows, err := db.QueryContext(ctx, "SELECT name, holder, token, acquired_at, expires_at FROM leases")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		lease, err := scanLease(rows)
+		if err != nil {
+			return nil, err
+		}
+		if lease.IsValid(now) {
+			leases[lease.Name] = lease
+		}
+	}
+
+	return leases, rows.Err()
+}
+
+// updateLease replaces the lease stored with the token, returning errNotFound if there is none
+func (s *Storage) updateLease(ctx context.Context, tx *sql.Tx, lease backr.Lease, token string, errNotFound error) error {
+	result, err := tx.ExecContext(ctx, s.rebind("UPDATE leases SET holder = ?, token = ?, acquired_at = ?, expires_at = ? WHERE name = ? AND token = ?"),
+		lease.Holder, lease.Token, encodeTime(lease.AcquiredAt), encodeTime(lease.ExpiresAt), lease.Name, token)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return errNotFound
+	}
+
+	return nil
+}
+
+// getLease reads a lease, in the transaction if tx is not nil
+func (s *Storage) getLease(ctx context.Context, tx *sql.Tx, name string) (backr.Lease, bool, error) {
+	query := s.rebind("SELECT name, holder, token, acquired_at, expires_at FROM leases WHERE name = ?")
+
+	var row *sql.Row
+	if tx != nil {
+		row = tx.QueryRowContext(ctx, query, name)
+	} else {
+		row = db.QueryRowContext(ctx, query, name)
+	}
+
+	lease, err := scanLease(row)
+	if err == sql.ErrNoRows {
+		return backr.Lease{}, false, nil
+	}
+	if err != nil {
+		return backr.Lease{}, false, err
+	}
+
+	return lease, true, nil
+}
+
+func scanLease(row interface{ Scan(...interface{}) error }) (backr.Lease, error) {
+	lease := backr.Lease{}
+	var acquiredAt, expiresAt string
+
+	if err := row.Scan(&lease.Name, &lease.Holder, &lease.Token, &acquiredAt, &expiresAt); err != nil {
+		return lease, err
+	}
+
+	var err error
+	if lease.AcquiredAt, err = decodeTime(acquiredAt); err != nil {
+		return lease, err
+	}
+	lease.ExpiresAt, err = decodeTime(expiresAt)
+
+	return lease, err
+}
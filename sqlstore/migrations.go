@@ -0,0 +1,132 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// migrations are applied in order: the schema version is the number of migrations applied.
+// Append a migration for each change of the schema, never reorder nor remove them.
+// The statements must be valid for both SQLite and PostgreSQL.
+var migrations = []struct {
+	description string
+	statements  []string
+}{
+	{
+		description: "create the projects, backups, runs and leases tables",
+		statements: []string{
+			`CREATE TABLE projects (
+				name TEXT PRIMARY KEY,
+				dir TEXT NOT NULL,
+				archiver TEXT NOT NULL,
+				timezone TEXT NOT NULL,
+				backup_window TEXT NOT NULL,
+				retention TEXT NOT NULL,
+				upload_rate_limit TEXT NOT NULL,
+				s3 TEXT NOT NULL,
+				restore_test TEXT NOT NULL,
+				last_restore_test TEXT NOT NULL,
+				paused BOOLEAN NOT NULL,
+				paused_until TEXT NOT NULL,
+				skip_next BOOLEAN NOT NULL
+			)`,
+			`CREATE TABLE backups (
+				project TEXT NOT NULL REFERENCES projects (name),
+				position INTEGER NOT NULL,
+				checksum TEXT NOT NULL,
+				ttl INTEGER NOT NULL,
+				min_age INTEGER NOT NULL,
+				period_unit INTEGER NOT NULL,
+				ignore_startup_time BOOLEAN NOT NULL,
+				last_execution TEXT NOT NULL,
+				PRIMARY KEY (project, position)
+			)`,
+			`CREATE TABLE runs (
+				project TEXT NOT NULL REFERENCES projects (name),
+				id INTEGER NOT NULL,
+				manual BOOLEAN NOT NULL,
+				started_at TEXT NOT NULL,
+				finished_at TEXT NOT NULL,
+				success BOOLEAN NOT NULL,
+				error TEXT NOT NULL,
+				archive TEXT NOT NULL,
+				destinations TEXT NOT NULL,
+				output TEXT NOT NULL,
+				PRIMARY KEY (project, id)
+			)`,
+			`CREATE TABLE leases (
+				name TEXT PRIMARY KEY,
+				holder TEXT NOT NULL,
+				token TEXT NOT NULL,
+				acquired_at TEXT NOT NULL,
+				expires_at TEXT NOT NULL
+			)`,
+		},
+	},
+	{
+		description: "add the conflicts of the projects",
+		statements: []string{
+			`ALTER TABLE projects ADD COLUMN conflicts TEXT NOT NULL DEFAULT 'null'`,
+		},
+	},
+	{
+		description: "add the size checks of the projects and the archive sizes of the runs",
+		statements: []string{
+			`ALTER TABLE projects ADD COLUMN size_check TEXT NOT NULL DEFAULT 'null'`,
+			`ALTER TABLE runs ADD COLUMN size BIGINT NOT NULL DEFAULT 0`,
+			`ALTER TABLE runs ADD COLUMN size_anomaly TEXT NOT NULL DEFAULT ''`,
+		},
+	},
+	{
+		description: "add the archive name templates of the projects",
+		statements: []string{
+			`ALTER TABLE projects ADD COLUMN archive_name_template TEXT NOT NULL DEFAULT ''`,
+		},
+	},
+}
+
+// migrate upgrades the schema of the database to the current version, in a single transaction
+func migrate(db *sql.DB, d dialect) error {
+	ctx := context.Background()
+
+	return transaction(ctx, db, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS schema_version (version INTEGER NOT NULL)"); err != nil {
+			return err
+		}
+
+		if d == postgres {
+			// the instances sharing the database must not migrate it concurrently
+			if _, err := tx.ExecContext(ctx, "LOCK TABLE schema_version IN EXCLUSIVE MODE"); err != nil {
+				return err
+			}
+		}
+
+		version := 0
+		err := tx.QueryRowContext(ctx, "SELECT version FROM schema_version").Scan(&version)
+		if err == sql.ErrNoRows {
+			if _, err := tx.ExecContext(ctx, "INSERT INTO schema_version (version) VALUES (0)"); err != nil {
+				return err
+			}
+		} else if err != nil {
+			return err
+		}
+
+		if version > len(migrations) {
+			return fmt.Errorf("The state was written by a newer version of backr (schema version %d, this version supports up to %d)", version, len(migrations))
+		}
+
+		for i := version; i < len(migrations); i++ {
+			log.WithField("version", i+1).Infoln("Migrating the state:", migrations[i].description)
+
+			for _, statement := range migrations[i].statements {
+				if _, err := tx.ExecContext(ctx, statement); err != nil {
+					return fmt.Errorf("Unable to migrate the state to schema version %d: %v", i+1, err)
+				}
+			}
+		}
+
+		_, err = tx.ExecContext(ctx, rebind(d, "UPDATE schema_version SET version = ?"), len(migrations))
+		return err
+	})
+}
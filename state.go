@@ -3,6 +3,8 @@ package backr
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"time"
 )
 
 type StateStorage interface {
@@ -16,11 +18,71 @@ type StateStorer interface {
 	ConfiguredProjects(ctx context.Context) (map[string]Project, error)
 	GetProject(ctx context.Context, name string) (*Project, error)
 	SaveProject(ctx context.Context, project Project) error
+	// UpdateProject applies update to a stored project and saves it, the concurrent updates of the project waiting for each other.
+	// It returns the updated project, or nil if the project does not exist (update is then not called)
+	UpdateProject(ctx context.Context, name string, update func(project *Project)) (*Project, error)
 	DeleteProject(ctx context.Context, project Project) error
 }
 
-func ProjectFromJSON(jsonData string) Project {
+// ErrLeaseHeld is returned when a lease is acquired while another holder owns it
+var ErrLeaseHeld = errors.New("lease held by another instance")
+
+// ErrLeaseLost is returned when a lease is renewed after it expired and has been acquired by another holder
+var ErrLeaseLost = errors.New("lease lost")
+
+// Lease represents the exclusive right of a backr instance to work on a project, until it expires
+type Lease struct {
+	Name   string `json:"name"`
+	Holder string `json:"holder"`
+	// Token identifies an acquisition, so that a holder never renews nor releases the lease of another execution
+	Token      string    `json:"token"`
+	AcquiredAt time.Time `json:"acquired_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// IsValid returns true if the lease is not expired at the given time
+func (l Lease) IsValid(now time.Time) bool {
+	return now.Before(l.ExpiresAt)
+}
+
+// Locker defines the behaviour of a storage able to share leases between several backr instances
+type Locker interface {
+	// Acquire takes the lease of name for ttl. If another valid lease exists, it is returned with ErrLeaseHeld
+	Acquire(ctx context.Context, name string, holder string, ttl time.Duration) (Lease, error)
+	// Renew extends a lease for ttl, returning ErrLeaseLost if it is not owned anymore
+	Renew(ctx context.Context, lease Lease, ttl time.Duration) (Lease, error)
+	// Release gives up a lease, if it is still owned
+	Release(ctx context.Context, lease Lease) error
+	// Leases returns the valid leases, by name
+	Leases(ctx context.Context) (map[string]Lease, error)
+}
+
+// StateExport represents the projects of a state storage, as exported to be imported into another one
+type StateExport struct {
+	ExportedAt time.Time `json:"exported_at"`
+	Projects   []Project `json:"projects"`
+}
+
+// ImportMode defines how the imported projects are applied to the existing ones
+type ImportMode string
+
+const (
+	// ImportMerge adds the projects not existing yet, and keeps the existing ones
+	ImportMerge ImportMode = "merge"
+	// ImportOverwrite adds the projects not existing yet, and replaces the existing ones
+	ImportOverwrite ImportMode = "overwrite"
+)
+
+// ImportReport counts the projects of an import, by outcome
+type ImportReport struct {
+	Created  int `json:"created"`
+	Replaced int `json:"replaced"`
+	Skipped  int `json:"skipped"`
+}
+
+// ProjectFromJSON decodes a project stored by a state storage
+func ProjectFromJSON(jsonData string) (Project, error) {
 	project := Project{}
-	json.Unmarshal([]byte(jsonData), &project)
-	return project
+	err := json.Unmarshal([]byte(jsonData), &project)
+	return project, err
 }
@@ -0,0 +1,105 @@
+package state
+
+import (
+	"context"
+	"sync"
+	"webup/backr"
+)
+
+// dryRunStorage wraps a storage to keep the changes in memory, without writing them
+type dryRunStorage struct {
+	backr.StateStorer
+
+	mu      sync.Mutex
+	saved   map[string]backr.Project
+	deleted map[string]bool
+
+	// updating serializes the updates, which read and save the projects
+	updating sync.Mutex
+}
+
+// the changes must outlive a single GetStorage call to simulate consecutive runs
+var dryRun = &dryRunStorage{
+	saved:   map[string]backr.Project{},
+	deleted: map[string]bool{},
+}
+
+func newDryRunStorage(storer backr.StateStorer) backr.StateStorer {
+	dryRun.mu.Lock()
+	defer dryRun.mu.Unlock()
+
+	dryRun.StateStorer = storer
+	return dryRun
+}
+
+// ConfiguredProjects returns the stored projects, with the in-memory changes applied
+func (s *dryRunStorage) ConfiguredProjects(ctx context.Context) (map[string]backr.Project, error) {
+	projects, err := s.StateStorer.ConfiguredProjects(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for name := range s.deleted {
+		delete(projects, name)
+	}
+	for name, project := range s.saved {
+		projects[name] = project
+	}
+
+	return projects, nil
+}
+
+// GetProject returns a stored project, with the in-memory changes applied
+func (s *dryRunStorage) GetProject(ctx context.Context, name string) (*backr.Project, error) {
+	s.mu.Lock()
+	if project, ok := s.saved[name]; ok {
+		s.mu.Unlock()
+		return &project, nil
+	}
+	deleted := s.deleted[name]
+	s.mu.Unlock()
+
+	if deleted {
+		return nil, nil
+	}
+
+	return s.StateStorer.GetProject(ctx, name)
+}
+
+// SaveProject keeps the project in memory only
+func (s *dryRunStorage) SaveProject(ctx context.Context, project backr.Project) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.deleted, project.Name)
+	s.saved[project.Name] = project
+	return nil
+}
+
+// UpdateProject applies update to a project, keeping the result in memory only
+func (s *dryRunStorage) UpdateProject(ctx context.Context, name string, update func(project *backr.Project)) (*backr.Project, error) {
+	s.updating.Lock()
+	defer s.updating.Unlock()
+
+	project, err := s.GetProject(ctx, name)
+	if err != nil || project == nil {
+		return nil, err
+	}
+
+	update(project)
+
+	return project, s.SaveProject(ctx, *project)
+}
+
+// DeleteProject forgets the project in memory only
+func (s *dryRunStorage) DeleteProject(ctx context.Context, project backr.Project) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.saved, project.Name)
+	s.deleted[project.Name] = true
+	return nil
+}
@@ -4,15 +4,53 @@ import (
 	"fmt"
 	"webup/backr"
 	"webup/backr/bolt"
+	"webup/backr/logging"
+	"webup/backr/memory"
+	"webup/backr/sqlstore"
 )
 
+var log = logging.Logger(logging.State)
+
+// GetStorage returns the configured storage. In dry-run mode, the changes are only kept in memory.
 func GetStorage(opts backr.Settings) (backr.StateStorer, error) {
-	if opts.StateStorage.GetType() == backr.StateStorageLocal {
+	storer, err := getStorage(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.DryRun {
+		return newDryRunStorage(storer), nil
+	}
+
+	return storer, nil
+}
+
+// GetLocker returns the leases shared by the instances using the configured storage
+func GetLocker(opts backr.Settings) (backr.Locker, error) {
+	storer, err := getStorage(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	locker, ok := storer.(backr.Locker)
+	if !ok {
+		return nil, fmt.Errorf("The state storage does not support leases")
+	}
+
+	return locker, nil
+}
+
+func getStorage(opts backr.Settings) (backr.StateStorer, error) {
+	switch opts.StateStorage.GetType() {
+	case backr.StateStorageLocal:
 		return bolt.GetStorage(opts)
-	} else if opts.StateStorage.GetType() == backr.StateStorageEtcd {
-		// return NewEtcdStorage(opts)
+	case backr.StateStorageSQL:
+		return sqlstore.GetStorage(opts)
+	case backr.StateStorageMemory:
+		return memory.GetStorage(opts)
 	}
 
+	// etcd: return NewEtcdStorage(opts)
 	return nil, fmt.Errorf("Unable to detect the state storage")
 }
 
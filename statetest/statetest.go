@@ -0,0 +1,479 @@
+// Package statetest checks that a state storage behaves as expected by backr.
+// Each storage runs the same suite from its tests:
+//
+//	func TestStorage(t *testing.T) {
+//		statetest.Run(t, func(t *testing.T) backr.StateStorer {
+//			return memory.New()
+//		})
+//	}
+package statetest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+	"webup/backr"
+)
+
+// Run executes the suite against the storages returned by newStorer, which must be empty.
+// The Cleanup method of each storage is called at the end of its test.
+// The lease tests are skipped if the storage does not implement backr.Locker.
+func Run(t *testing.T, newStorer func(t *testing.T) backr.StateStorer) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, storer backr.StateStorer)
+	}{
+		{"EmptyStorage", testEmptyStorage},
+		{"SaveProject", testSaveProject},
+		{"SaveProjectReplaces", testSaveProjectReplaces},
+		{"ConfiguredProjects", testConfiguredProjects},
+		{"UpdateProject", testUpdateProject},
+		{"ConcurrentUpdates", testConcurrentUpdates},
+		{"DeleteProject", testDeleteProject},
+		{"ProjectsAreCopies", testProjectsAreCopies},
+		{"Leases", testLeases},
+		{"ExpiredLeases", testExpiredLeases},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			storer := newStorer(t)
+			defer storer.Cleanup()
+
+			test.run(t, storer)
+		})
+	}
+}
+
+// testEmptyStorage checks that an empty storage returns no project, without error
+func testEmptyStorage(t *testing.T, storer backr.StateStorer) {
+	ctx := context.Background()
+
+	projects, err := storer.ConfiguredProjects(ctx)
+	if err != nil {
+		t.Fatalf("ConfiguredProjects: %v", err)
+	}
+	if projects == nil || len(projects) != 0 {
+		t.Errorf("ConfiguredProjects: expected an empty map, got %v", projects)
+	}
+
+	project, err := storer.GetProject(ctx, "unknown")
+	if err != nil || project != nil {
+		t.Errorf("GetProject of an unknown project: expected nil without error, got %v (%v)", project, err)
+	}
+
+	if err := storer.DeleteProject(ctx, backr.Project{Name: "unknown"}); err != nil {
+		t.Errorf("DeleteProject of an unknown project: %v", err)
+	}
+}
+
+// testSaveProject checks that every field of a saved project is returned
+func testSaveProject(t *testing.T, storer backr.StateStorer) {
+	ctx := context.Background()
+	project := sampleProject("app")
+
+	if err := storer.SaveProject(ctx, project); err != nil {
+		t.Fatalf("SaveProject: %v", err)
+	}
+
+	stored, err := storer.GetProject(ctx, project.Name)
+	if err != nil {
+		t.Fatalf("GetProject: %v", err)
+	}
+	if stored == nil {
+		t.Fatalf("GetProject: the saved project is not found")
+	}
+	assertProject(t, "GetProject", *stored, project)
+}
+
+// testSaveProjectReplaces checks that saving a project again replaces all its fields, including its lists
+func testSaveProjectReplaces(t *testing.T, storer backr.StateStorer) {
+	ctx := context.Background()
+	project := sampleProject("app")
+
+	if err := storer.SaveProject(ctx, project); err != nil {
+		t.Fatalf("SaveProject: %v", err)
+	}
+
+	project.Dir = "/srv/other"
+	project.Backups = project.Backups[:1]
+	project.Backups[0].LastExecution = project.Backups[0].LastExecution.Add(24 * time.Hour)
+	project.Runs = []backr.Run{project.Runs[1]}
+	project.Window = nil
+	project.Paused = false
+	project.PausedUntil = time.Time{}
+	project.Conflicts = nil
+
+	if err := storer.SaveProject(ctx, project); err != nil {
+		t.Fatalf("SaveProject again: %v", err)
+	}
+
+	stored, err := storer.GetProject(ctx, project.Name)
+	if err != nil || stored == nil {
+		t.Fatalf("GetProject: expected the project, got %v (%v)", stored, err)
+	}
+	assertProject(t, "GetProject", *stored, project)
+}
+
+// testUpdateProject checks that an update is applied to the stored project, and that an unknown project is not created
+func testUpdateProject(t *testing.T, storer backr.StateStorer) {
+	ctx := context.Background()
+
+	updated, err := storer.UpdateProject(ctx, "unknown", func(project *backr.Project) {
+		t.Errorf("UpdateProject of an unknown project: update must not be called")
+	})
+	if err != nil || updated != nil {
+		t.Errorf("UpdateProject of an unknown project: expected nil without error, got %v (%v)", updated, err)
+	}
+	if project, _ := storer.GetProject(ctx, "unknown"); project != nil {
+		t.Errorf("UpdateProject of an unknown project: the project must not be created")
+	}
+
+	project := sampleProject("app")
+	if err := storer.SaveProject(ctx, project); err != nil {
+		t.Fatalf("SaveProject: %v", err)
+	}
+
+	project.Dir = "/srv/other"
+	project.Paused = false
+	project.Runs = project.Runs[:1]
+	updated, err = storer.UpdateProject(ctx, project.Name, func(stored *backr.Project) {
+		stored.Dir = project.Dir
+		stored.Paused = project.Paused
+		stored.Runs = stored.Runs[:1]
+	})
+	if err != nil || updated == nil {
+		t.Fatalf("UpdateProject: expected the project, got %v (%v)", updated, err)
+	}
+	assertProject(t, "UpdateProject", *updated, project)
+
+	stored, err := storer.GetProject(ctx, project.Name)
+	if err != nil || stored == nil {
+		t.Fatalf("GetProject: expected the project, got %v (%v)", stored, err)
+	}
+	assertProject(t, "GetProject", *stored, project)
+}
+
+// testConcurrentUpdates checks that the concurrent updates of a project are all applied, none overwriting another
+func testConcurrentUpdates(t *testing.T, storer backr.StateStorer) {
+	ctx := context.Background()
+	project := sampleProject("app")
+	project.Conflicts = nil
+	if err := storer.SaveProject(ctx, project); err != nil {
+		t.Fatalf("SaveProject: %v", err)
+	}
+
+	const updates = 20
+	var wg sync.WaitGroup
+	for i := 0; i < updates; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			_, err := storer.UpdateProject(ctx, project.Name, func(stored *backr.Project) {
+				stored.Conflicts = append(stored.Conflicts, fmt.Sprintf("/srv/update-%d/backup.yml", i))
+			})
+			if err != nil {
+				t.Errorf("UpdateProject: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	stored, err := storer.GetProject(ctx, project.Name)
+	if err != nil || stored == nil {
+		t.Fatalf("GetProject: expected the project, got %v (%v)", stored, err)
+	}
+	if len(stored.Conflicts) != updates {
+		t.Errorf("expected the %d updates to be applied, got %d", updates, len(stored.Conflicts))
+	}
+}
+
+// testConfiguredProjects checks that all the projects are returned, by name
+func testConfiguredProjects(t *testing.T, storer backr.StateStorer) {
+	ctx := context.Background()
+	expected := map[string]backr.Project{}
+
+	for _, name := range []string{"app", "blog", "shop"} {
+		project := sampleProject(name)
+		if err := storer.SaveProject(ctx, project); err != nil {
+			t.Fatalf("SaveProject: %v", err)
+		}
+		expected[name] = project
+	}
+
+	projects, err := storer.ConfiguredProjects(ctx)
+	if err != nil {
+		t.Fatalf("ConfiguredProjects: %v", err)
+	}
+	if len(projects) != len(expected) {
+		t.Fatalf("ConfiguredProjects: expected %d projects, got %d", len(expected), len(projects))
+	}
+	for name, project := range expected {
+		stored, ok := projects[name]
+		if !ok {
+			t.Errorf("ConfiguredProjects: the project '%s' is missing", name)
+			continue
+		}
+		assertProject(t, "ConfiguredProjects", stored, project)
+	}
+}
+
+// testDeleteProject checks that a deleted project is not returned anymore, and that the other ones are kept
+func testDeleteProject(t *testing.T, storer backr.StateStorer) {
+	ctx := context.Background()
+	app, blog := sampleProject("app"), sampleProject("blog")
+
+	for _, project := range []backr.Project{app, blog} {
+		if err := storer.SaveProject(ctx, project); err != nil {
+			t.Fatalf("SaveProject: %v", err)
+		}
+	}
+
+	if err := storer.DeleteProject(ctx, app); err != nil {
+		t.Fatalf("DeleteProject: %v", err)
+	}
+
+	if project, err := storer.GetProject(ctx, app.Name); err != nil || project != nil {
+		t.Errorf("GetProject of a deleted project: expected nil without error, got %v (%v)", project, err)
+	}
+
+	projects, err := storer.ConfiguredProjects(ctx)
+	if err != nil {
+		t.Fatalf("ConfiguredProjects: %v", err)
+	}
+	if _, ok := projects[app.Name]; ok || len(projects) != 1 {
+		t.Errorf("ConfiguredProjects: expected the project '%s' only, got %d projects", blog.Name, len(projects))
+	}
+
+	if err := storer.DeleteProject(ctx, app); err != nil {
+		t.Errorf("DeleteProject of a deleted project: %v", err)
+	}
+
+	// a deleted project can be saved again
+	if err := storer.SaveProject(ctx, app); err != nil {
+		t.Fatalf("SaveProject of a deleted project: %v", err)
+	}
+	if project, err := storer.GetProject(ctx, app.Name); err != nil || project == nil {
+		t.Errorf("GetProject of a project saved again: expected the project, got %v (%v)", project, err)
+	}
+}
+
+// testProjectsAreCopies checks that modifying a returned project does not change the stored one
+func testProjectsAreCopies(t *testing.T, storer backr.StateStorer) {
+	ctx := context.Background()
+	project := sampleProject("app")
+
+	if err := storer.SaveProject(ctx, project); err != nil {
+		t.Fatalf("SaveProject: %v", err)
+	}
+
+	stored, err := storer.GetProject(ctx, project.Name)
+	if err != nil || stored == nil {
+		t.Fatalf("GetProject: expected the project, got %v (%v)", stored, err)
+	}
+	stored.Dir = "/changed"
+	stored.Backups[0].Checksum = "changed"
+	stored.Runs[0].Error = "changed"
+	stored.Retention.KeepLast = 100
+
+	projects, err := storer.ConfiguredProjects(ctx)
+	if err != nil {
+		t.Fatalf("ConfiguredProjects: %v", err)
+	}
+	assertProject(t, "ConfiguredProjects after a change of the returned project", projects[project.Name], project)
+}
+
+// testLeases checks that a lease is exclusive until it is released
+func testLeases(t *testing.T, storer backr.StateStorer) {
+	locker := lockerOrSkip(t, storer)
+	ctx := context.Background()
+
+	lease, err := locker.Acquire(ctx, "app", "host1", time.Minute)
+	if err != nil {
+		t.Fatalf("Acquire: %v", err)
+	}
+	if lease.Name != "app" || lease.Holder != "host1" || lease.Token == "" || !lease.IsValid(time.Now()) {
+		t.Fatalf("Acquire: unexpected lease %+v", lease)
+	}
+
+	held, err := locker.Acquire(ctx, "app", "host2", time.Minute)
+	if err != backr.ErrLeaseHeld {
+		t.Fatalf("Acquire of a held lease: expected ErrLeaseHeld, got %v", err)
+	}
+	if held.Holder != "host1" {
+		t.Errorf("Acquire of a held lease: expected the lease of host1, got %+v", held)
+	}
+
+	// the leases are independent
+	if _, err := locker.Acquire(ctx, "blog", "host2", time.Minute); err != nil {
+		t.Fatalf("Acquire of another lease: %v", err)
+	}
+
+	leases, err := locker.Leases(ctx)
+	if err != nil {
+		t.Fatalf("Leases: %v", err)
+	}
+	if len(leases) != 2 || leases["app"].Holder != "host1" || leases["blog"].Holder != "host2" {
+		t.Errorf("Leases: unexpected leases %+v", leases)
+	}
+
+	renewed, err := locker.Renew(ctx, lease, time.Hour)
+	if err != nil {
+		t.Fatalf("Renew: %v", err)
+	}
+	if !renewed.ExpiresAt.After(lease.ExpiresAt) || renewed.Token != lease.Token {
+		t.Errorf("Renew: unexpected lease %+v", renewed)
+	}
+
+	if err := locker.Release(ctx, renewed); err != nil {
+		t.Fatalf("Release: %v", err)
+	}
+	if err := locker.Release(ctx, renewed); err != nil {
+		t.Errorf("Release of a released lease: %v", err)
+	}
+	if _, err := locker.Renew(ctx, renewed, time.Minute); err != backr.ErrLeaseLost {
+		t.Errorf("Renew of a released lease: expected ErrLeaseLost, got %v", err)
+	}
+
+	if _, err := locker.Acquire(ctx, "app", "host2", time.Minute); err != nil {
+		t.Errorf("Acquire of a released lease: %v", err)
+	}
+}
+
+// testExpiredLeases checks that an expired lease is kept by its holder until another one acquires it
+func testExpiredLeases(t *testing.T, storer backr.StateStorer) {
+	locker := lockerOrSkip(t, storer)
+	ctx := context.Background()
+	ttl := 50 * time.Millisecond
+
+	lease, err := locker.Acquire(ctx, "app", "host1", ttl)
+	if err != nil {
+		t.Fatalf("Acquire: %v", err)
+	}
+	time.Sleep(2 * ttl)
+
+	leases, err := locker.Leases(ctx)
+	if err != nil {
+		t.Fatalf("Leases: %v", err)
+	}
+	if len(leases) != 0 {
+		t.Errorf("Leases: expected no valid lease, got %+v", leases)
+	}
+
+	// nobody acquired the lease meanwhile
+	if lease, err = locker.Renew(ctx, lease, ttl); err != nil {
+		t.Fatalf("Renew of an expired lease: %v", err)
+	}
+	time.Sleep(2 * ttl)
+
+	taken, err := locker.Acquire(ctx, "app", "host2", time.Minute)
+	if err != nil {
+		t.Fatalf("Acquire of an expired lease: %v", err)
+	}
+
+	if _, err := locker.Renew(ctx, lease, time.Minute); err != backr.ErrLeaseLost {
+		t.Errorf("Renew of a lease acquired by another holder: expected ErrLeaseLost, got %v", err)
+	}
+
+	// the previous holder must not release the lease of the new one
+	if err := locker.Release(ctx, lease); err != nil {
+		t.Errorf("Release of a lease acquired by another holder: %v", err)
+	}
+	leases, err = locker.Leases(ctx)
+	if err != nil {
+		t.Fatalf("Leases: %v", err)
+	}
+	if leases["app"].Token != taken.Token {
+		t.Errorf("Leases: expected the lease of host2, got %+v", leases["app"])
+	}
+}
+
+func lockerOrSkip(t *testing.T, storer backr.StateStorer) backr.Locker {
+	locker, ok := storer.(backr.Locker)
+	if !ok {
+		t.Skip("The storage does not support leases")
+	}
+	return locker
+}
+
+// sampleProject returns a project with all its fields set
+func sampleProject(name string) backr.Project {
+	// the storages must keep the time zones
+	zone := time.FixedZone("", 2*60*60)
+	date := time.Date(2020, 3, 14, 1, 2, 3, 456789000, zone)
+
+	return backr.Project{
+		Name: name,
+		Backups: []backr.Backup{
+			{
+				BackupSpec:    backr.BackupSpec{TTL: 30, MinAge: 1, PeriodUnit: 24},
+				Checksum:      "checksum-1",
+				LastExecution: date,
+			},
+			{
+				BackupSpec: backr.BackupSpec{MinAge: 7, IgnoreStartupTime: true},
+				Checksum:   "checksum-2",
+			},
+		},
+		Dir:                 "/srv/" + name,
+		Archiver:            backr.Archiver{Type: "tar2", OutputFileExtension: "tar.gz", Command: []string{"tar", "czf", "-", "."}},
+		Timezone:            "Europe/Paris",
+		Window:              &backr.BackupWindow{Start: "22:00", End: "05:00", CancelAtEnd: true},
+		Retention:           &backr.RetentionPolicy{KeepLast: 3, KeepDaily: 7},
+		UploadRateLimit:     "5MB",
+		ArchiveNameTemplate: "{{.Date}}/{{.Clock}}-{{.Random}}",
+		S3:                  &backr.S3ObjectSettings{StorageClass: "STANDARD_IA", Tags: map[string]string{"env": "test"}},
+		RestoreTest:         &backr.RestoreTestSpec{Every: 7, Command: []string{"tar", "xzf", "archive"}},
+		LastRestoreTest:     &backr.RestoreTestResult{StartedAt: date, FinishedAt: date.Add(time.Minute), Success: true},
+		Paused:              true,
+		PausedUntil:         date.Add(48 * time.Hour),
+		SkipNext:            true,
+		Conflicts:           []string{"/srv/a/backup.yml", "/srv/b/backup.yml"},
+		SizeCheck:           &backr.SizeCheckSpec{MinSize: "10MB", MaxDecrease: 50, Action: backr.SizeCheckFail},
+		Runs: []backr.Run{
+			{
+				ID:           1,
+				StartedAt:    date,
+				FinishedAt:   date.Add(time.Minute),
+				Error:        "archiver failed",
+				Size:         1024,
+				SizeAnomaly:  "archive size 1.0 KB is under the minimum of 10.0 MB",
+				Destinations: []backr.DestinationResult{},
+			},
+			{
+				ID:           2,
+				Manual:       true,
+				StartedAt:    date.Add(time.Hour),
+				FinishedAt:   date.Add(time.Hour + time.Minute),
+				Success:      true,
+				Archive:      name + "/archive.tar.gz",
+				Size:         42 << 20,
+				Destinations: []backr.DestinationResult{{Destination: "main", Success: true}},
+				Output:       "done",
+			},
+		},
+	}
+}
+
+// assertProject compares the projects through their JSON encoding, as it is the form given to the users
+func assertProject(t *testing.T, context string, actual backr.Project, expected backr.Project) {
+	t.Helper()
+
+	actualJSON, err := json.Marshal(actual)
+	if err != nil {
+		t.Fatalf("%s: %v", context, err)
+	}
+	expectedJSON, err := json.Marshal(expected)
+	if err != nil {
+		t.Fatalf("%s: %v", context, err)
+	}
+
+	if string(actualJSON) != string(expectedJSON) {
+		t.Errorf("%s: unexpected project\n got: %s\nwant: %s", context, actualJSON, expectedJSON)
+	}
+}
@@ -9,8 +9,45 @@ type Status struct {
 }
 
 type ProjectStatus struct {
-	Name              string         `json:"name"`
-	ConfiguredBackups []BackupStatus `json:"backups"`
+	Name              string             `json:"name"`
+	ConfiguredBackups []BackupStatus     `json:"backups"`
+	Timezone          string             `json:"timezone"`
+	Window            string             `json:"window,omitempty"`
+	Paused            bool               `json:"paused"`
+	PausedUntil       *time.Time         `json:"paused_until,omitempty"`
+	SkipNext          bool               `json:"skip_next"`
+	RestoreTest       *RestoreTestStatus `json:"restore_test,omitempty"`
+	// Size compares the last archive with the previous ones, once an archive has been produced
+	Size *SizeStatus `json:"size,omitempty"`
+	// Conflicts lists the backup.yml files declaring the name of the project, if there are several of them
+	Conflicts []string `json:"conflicts,omitempty"`
+	// Lease is set while an instance works on the project
+	Lease *LeaseStatus `json:"lease,omitempty"`
+}
+
+// LeaseStatus represents the instance working on a project
+type LeaseStatus struct {
+	Holder     string    `json:"holder"`
+	AcquiredAt time.Time `json:"acquired_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// RestoreTestStatus represents the state of the restore drills of a project
+type RestoreTestStatus struct {
+	LastExecution *time.Time `json:"last_exec,omitempty"`
+	NextExecution time.Time  `json:"next_exec"` // zero if the first drill is pending
+	Success       bool       `json:"success"`
+	Error         string     `json:"error,omitempty"`
+	Archive       string     `json:"archive,omitempty"`
+	IsHealthy     bool       `json:"is_healthy"`
+}
+
+// SizeStatus represents the size of the last archive of a project, compared to the baseline of the previous ones
+type SizeStatus struct {
+	LastSize  int64  `json:"last_size"`
+	Baseline  int64  `json:"baseline"` // zero if there is no previous archive
+	Anomaly   string `json:"anomaly,omitempty"`
+	IsHealthy bool   `json:"is_healthy"`
 }
 
 type BackupStatus struct {
@@ -0,0 +1,204 @@
+package tasks
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+	"webup/backr"
+	"webup/backr/archive"
+	"webup/backr/s3"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ErrNoRestoreTest is returned when a project has no restore drill configured
+var ErrNoRestoreTest = fmt.Errorf("No restore test configured for this project")
+
+// ErrRestoreTestDryRun is returned when a restore drill is requested in dry-run mode
+var ErrRestoreTestDryRun = fmt.Errorf("Dry run: the restore test is not executed")
+
+// RunRestoreTest executes immediately the restore drill of a project, and records its result
+func RunRestoreTest(ctx context.Context, projectName string) (*backr.RestoreTestResult, error) {
+	opts, ok := backr.SettingsFromContext(ctx)
+	if !ok {
+		return nil, fmt.Errorf("Unable to get options from context")
+	}
+
+	project, err := getProject(ctx, projectName)
+	if err != nil {
+		return nil, err
+	}
+
+	if project.RestoreTest == nil {
+		return nil, ErrNoRestoreTest
+	}
+
+	if opts.S3 == nil {
+		return nil, fmt.Errorf("S3 is not configured")
+	}
+
+	run, ok := latestArchive(*project)
+	if !ok {
+		return nil, ErrNoArchive
+	}
+
+	// the drill runs commands, and records its result
+	if opts.DryRun {
+		log.WithFields(logrus.Fields{
+			"project": project.Name,
+			"run_id":  run.ID,
+			"archive": run.Archive,
+		}).Infoln("Dry run: restore test would be executed")
+
+		return nil, ErrRestoreTestDryRun
+	}
+
+	result := restoreTest(ctx, *project, run, opts)
+
+	persistCtx, cancel := persistContext(ctx)
+	err = updateProject(persistCtx, projectName, func(project *backr.Project) {
+		project.LastRestoreTest = &result
+	})
+	cancel()
+	if err != nil {
+		log.WithFields(logrus.Fields{
+			"project": projectName,
+			"err":     err,
+		}).Errorln("Unable to save the restore test result into state storage")
+	}
+
+	return &result, nil
+}
+
+// performRestoreTest executes the restore drill of a project if it is due, and records its result into the project
+func performRestoreTest(ctx context.Context, project *backr.Project, opts backr.Settings) {
+	if project.RestoreTest == nil || opts.S3 == nil || time.Now().Before(project.NextRestoreTest()) {
+		return
+	}
+
+	// the drill is performed after the next start
+	if backr.ShuttingDown(ctx) || ctx.Err() != nil {
+		return
+	}
+
+	logEntry := log.WithField("project", project.Name)
+
+	run, ok := latestArchive(*project)
+	if !ok {
+		logEntry.Debugln("No archive to restore yet. Skipping restore test.")
+		return
+	}
+
+	logEntry = logEntry.WithField("run_id", run.ID)
+
+	if opts.DryRun {
+		logEntry.WithField("archive", run.Archive).Infoln("Dry run: restore test would be executed")
+		return
+	}
+
+	logEntry.Infoln("Executing restore test...")
+
+	result := restoreTest(ctx, *project, run, opts)
+	project.LastRestoreTest = &result
+
+	if result.Success {
+		logEntry.Infoln("Restore test OK")
+	} else {
+		logEntry.Errorln("Restore test failed:", result.Error)
+	}
+}
+
+// restoreTest downloads the archive of a run, and executes the restore drill of the project on it
+func restoreTest(ctx context.Context, project backr.Project, run backr.Run, opts backr.Settings) backr.RestoreTestResult {
+	output := archive.NewOutputBuffer(backr.MaxRunOutputSize)
+	result := backr.RestoreTestResult{
+		StartedAt: time.Now(),
+		Archive:   run.Archive,
+	}
+
+	err := func() error {
+		ctx, cancel := context.WithTimeout(ctx, project.RestoreTest.GetTimeout())
+		defer cancel()
+
+		dir, err := ioutil.TempDir("", "backr-restore-")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(dir)
+
+		scratchDir := filepath.Join(dir, "scratch")
+		if err := os.Mkdir(scratchDir, 0700); err != nil {
+			return err
+		}
+
+		file := filepath.Join(dir, path.Base(run.Archive))
+		result.Destination, err = downloadArchive(ctx, project, run, file, opts)
+		if err != nil {
+			return err
+		}
+
+		return archive.ExecuteRestoreTest(ctx, project, *project.RestoreTest, file, scratchDir, output)
+	}()
+
+	result.FinishedAt = time.Now()
+	result.Output = output.String()
+	if err != nil {
+		result.Error = err.Error()
+	} else {
+		result.Success = true
+	}
+
+	return result
+}
+
+// downloadArchive downloads the archive of a run from the first destination where it is available and matches its manifest
+func downloadArchive(ctx context.Context, project backr.Project, run backr.Run, file string, opts backr.Settings) (string, error) {
+	objects := project.ObjectSettings(opts.S3Objects)
+
+	var err error
+	for _, destination := range opts.GetDestinations() {
+		err = downloadVerifiedArchive(ctx, run.Archive, file, objects, destination)
+		if err == nil {
+			return destination.Name, nil
+		}
+
+		log.WithFields(logrus.Fields{
+			"project":     project.Name,
+			"destination": destination.Name,
+			"err":         err,
+		}).Warnln("Unable to download the archive from a destination")
+	}
+
+	return "", fmt.Errorf("unable to download the archive from any destination: %v", err)
+}
+
+// downloadVerifiedArchive downloads an archive from a destination, and checks it with its manifest if it has one
+func downloadVerifiedArchive(ctx context.Context, name string, file string, objects backr.S3ObjectSettings, destination backr.S3Settings) error {
+	manifest, err := s3.GetManifest(ctx, name, objects, destination)
+	if err != nil {
+		return err
+	}
+
+	if err := s3.DownloadArchive(ctx, name, file, objects, destination); err != nil {
+		return err
+	}
+
+	if manifest != nil {
+		return manifest.Verify(file)
+	}
+	return nil
+}
+
+// latestArchive returns the last run which has produced an archive
+func latestArchive(project backr.Project) (backr.Run, bool) {
+	for i := len(project.Runs) - 1; i >= 0; i-- {
+		if project.Runs[i].Archive != "" {
+			return project.Runs[i], true
+		}
+	}
+	return backr.Run{}, false
+}
@@ -2,18 +2,23 @@ package tasks
 
 import (
 	"context"
+	"errors"
+	"strings"
 	"time"
 	"webup/backr"
 	"webup/backr/archive"
+	"webup/backr/logging"
 	"webup/backr/state"
 
 	"fmt"
 
-	log "github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus"
 )
 
+var log = logging.Logger(logging.Scheduler)
+
 // PerformBackup executes the process that start backups from a specific time, and executes the associated command
-// returns false if a backup has failed
+// returns true if a backup has failed
 func PerformBackup(ctx context.Context) bool {
 
 	opts, ok := backr.SettingsFromContext(ctx)
@@ -22,13 +27,38 @@ func PerformBackup(ctx context.Context) bool {
 		return false
 	}
 
+	backupFailed, _ := performBackup(ctx, opts)
+	return backupFailed
+}
+
+// PlanBackup runs the backup process in dry-run mode, and returns the backups that would be executed
+func PlanBackup(ctx context.Context) ([]backr.ExecutionPlan, error) {
+
+	opts, ok := backr.SettingsFromContext(ctx)
+	if !ok {
+		return nil, fmt.Errorf("Unable to get options from context")
+	}
+
+	opts.DryRun = true
+	ctx = backr.NewContextWithSettings(ctx, opts)
+
+	backupFailed, plans := performBackup(ctx, opts)
+	if backupFailed {
+		return plans, fmt.Errorf("Unable to plan the backups (see logs)")
+	}
+
+	return plans, nil
+}
+
+func performBackup(ctx context.Context, opts backr.Settings) (bool, []backr.ExecutionPlan) {
+
 	// get a state storage
 	stateStorage, err := state.GetStorage(opts)
 	if err != nil {
-		log.WithFields(log.Fields{
+		log.WithFields(logrus.Fields{
 			"err": err,
 		}).Errorln("Unable to connect to state storage")
-		return false
+		return true, nil
 	}
 
 	backupExecutionTime := time.Now()
@@ -38,43 +68,140 @@ func PerformBackup(ctx context.Context) bool {
 	// fetch all configured backups
 	projects, err := stateStorage.ConfiguredProjects(ctx)
 	if err != nil {
-		log.WithFields(log.Fields{
+		log.WithFields(logrus.Fields{
 			"err": err,
 		}).Errorln("Unable to get configured projects from state storage")
-		return false
+		return true, nil
 	}
 
 	backupFailed := false
+	plans := []backr.ExecutionPlan{}
 
 	for _, project := range projects {
 
+		// the running backup is completed, but no other one is started
+		if backr.ShuttingDown(ctx) || ctx.Err() != nil {
+			log.Infoln("Stopping: the remaining projects are skipped until the next start.")
+			break
+		}
+
+		// an expired pause is cleared when the project is saved
+		if project.Paused && !project.IsPaused(backupExecutionTime) {
+			project.Resume()
+		}
+
+		// the project is saved at the end with the changes of the scheduler only
+		changes := scheduledChanges{executions: map[string]time.Time{}}
+
+		if project.IsPaused(backupExecutionTime) {
+			log.WithField("project", project.Name).Debugln("Project paused. Skipping.")
+			continue
+		}
+
+		if len(project.Conflicts) > 0 {
+			log.WithFields(logrus.Fields{
+				"project": project.Name,
+				"files":   strings.Join(project.Conflicts, ", "),
+			}).Warnln("Project name declared by several backup.yml files. Skipping.")
+			continue
+		}
+
+		timeSpec := project.TimeSpec(opts.TimeSpec)
+
+		// the instances sharing the state storage must not work on the same project,
+		// and only the projects held under a lease are saved
+		projectCtx, release, leased := ctx, func() {}, false
+		if !opts.DryRun && projectIsDue(project, timeSpec, opts) {
+			var err error
+			projectCtx, release, err = acquireProject(ctx, project.Name, opts)
+			if errors.Is(err, backr.ErrLeaseHeld) {
+				log.WithFields(logrus.Fields{
+					"project": project.Name,
+					"err":     err,
+				}).Infoln("Project locked by another instance. Skipping.")
+				continue
+			}
+			if err != nil {
+				log.WithFields(logrus.Fields{
+					"project": project.Name,
+					"err":     err,
+				}).Errorln("Unable to lock the project")
+				backupFailed = true
+				continue
+			}
+			leased = true
+
+			// another instance may have updated the project before the lease is acquired
+			if current, err := stateStorage.GetProject(ctx, project.Name); err == nil && current != nil {
+				project = *current
+				timeSpec = project.TimeSpec(opts.TimeSpec)
+			}
+		}
+
+		// the archive stands for every backup needed, so it is retained as long as the longest of them
+		neededTTL := 0
+		for _, backup := range project.Backups {
+			if backup.TTL > neededTTL && backupIsNeeded(backup, timeSpec, opts) {
+				neededTTL = backup.TTL
+			}
+		}
+
 		// iterate over each item
 		backupDone := false
+		backupSkipped := false
 		for i := range project.Backups {
 			backup := project.Backups[i]
 
 			// prepare a log entry
-			logEntry := log.WithFields(log.Fields{
-				"name":                project.Name,
+			logEntry := log.WithFields(logrus.Fields{
+				"project":             project.Name,
+				"backup":              backup.Checksum,
 				"min_age":             backup.MinAge,
 				"period_unit":         backup.PeriodUnit,
 				"ignore_startup_time": backup.IgnoreStartupTime,
 				"last_exec":           backup.LastExecution,
 			})
 
-			logEntry.Debugln("Next execution scheduled at", backup.GetNextBackupTime(opts.TimeSpec, opts.StartupTime))
+			logEntry.Debugln("Next execution scheduled at", backup.GetNextBackupTime(timeSpec, opts.StartupTime))
 
 			// if the backup is needed
-			if backupIsNeeded(backup, opts) {
+			if backupIsNeeded(backup, timeSpec, opts) {
 
 				// check if a backup is already done with a previous item
-				if !backupDone {
+				if project.SkipNext && !backupDone {
+					logEntry.Infoln("Skipping backup as requested.")
+
+					backupDone = true
+					backupSkipped = true
+				} else if !backupDone && opts.DryRun {
+					plan := archive.Plan(project, opts)
+					plans = append(plans, plan)
+
+					logEntry.WithFields(logrus.Fields{
+						"command": plan.Command,
+						"object":  plan.Object,
+					}).Infoln("Dry run: backup would be executed")
+
+					backupDone = true
+				} else if !backupDone {
 					logEntry.Infoln("Executing backup...")
 
 					// perform backup command
-					_, err := archive.ExecuteBackup(project, backup, false, opts)
+					executedBackup := backup
+					executedBackup.TTL = neededTTL
+
+					backupCtx, cancel := windowContext(projectCtx, backup, timeSpec)
+					_, run, err := executeBackup(backupCtx, project, executedBackup, archive.Options{}, opts)
+					cancel()
+					if err != nil && backupCtx.Err() == context.DeadlineExceeded {
+						run.Error = "cancelled: end of the backup window reached"
+					}
+					run = project.AddRun(run)
+					changes.runs = append(changes.runs, run)
+					logEntry = logEntry.WithField("run_id", run.ID)
+
 					if err != nil {
-						logEntry.Errorln("Backup execution error:", err)
+						logEntry.Errorln("Backup execution error:", run.Error)
 						backupFailed = true
 					} else {
 						logEntry.Infoln("Backup execution OK")
@@ -90,58 +217,148 @@ func PerformBackup(ctx context.Context) bool {
 				if backupDone {
 					// store the backup time for this backup
 					backup.LastExecution = backupExecutionTime
+					changes.executions[backup.Checksum] = backupExecutionTime
 
-					logEntry.WithField("next", backup.GetNextBackupTime(opts.TimeSpec, opts.StartupTime)).Infoln("Next backup scheduled.")
+					logEntry.WithField("next", backup.GetNextBackupTime(timeSpec, opts.StartupTime)).Infoln("Next backup scheduled.")
 				}
 
 				project.Backups[i] = backup
 			}
 		}
 
-		// save changes into state storage
-		err = stateStorage.SaveProject(ctx, project)
-		if err != nil {
-			log.WithFields(log.Fields{
-				"name": project.Name,
-				"err":  err,
-			}).Errorln("Unable to update state in state storage")
+		if backupSkipped {
+			project.SkipNext = false
+			changes.skipped = true
+		} else if backupDone && project.Retention != nil && opts.S3 != nil && !opts.DryRun {
+			// apply the retention policy now that a new archive is available
+			if _, err := pruneArchives(project, opts, false); err != nil {
+				log.WithFields(logrus.Fields{
+					"project": project.Name,
+					"err":     err,
+				}).Errorln("Unable to prune archives")
+			}
+		}
+
+		lastRestoreTest := project.LastRestoreTest
+		performRestoreTest(projectCtx, &project, opts)
+		if project.LastRestoreTest != lastRestoreTest {
+			changes.restoreTest = project.LastRestoreTest
 		}
 
+		// save changes into state storage, keeping the ones made meanwhile (pause, manual backups...)
+		if leased {
+			persistCtx, cancel := persistContext(ctx)
+			err = updateProject(persistCtx, project.Name, changes.apply)
+			cancel()
+			if err != nil {
+				log.WithFields(logrus.Fields{
+					"project": project.Name,
+					"err":     err,
+				}).Errorln("Unable to update state in state storage")
+			}
+		}
+
+		release()
+
 	}
 
 	log.Debugln("Backup process finished.")
 
-	return backupFailed
+	return backupFailed, plans
+}
+
+// scheduledChanges are the changes of the scheduler to a project during a backup process
+type scheduledChanges struct {
+	// executions are the new execution times of the backups, by checksum
+	executions  map[string]time.Time
+	runs        []backr.Run
+	skipped     bool
+	restoreTest *backr.RestoreTestResult
+}
+
+// apply records the changes into the current state of the project, leaving the fields the scheduler does not own
+func (c scheduledChanges) apply(project *backr.Project) {
+	if project.Paused && !project.IsPaused(time.Now()) {
+		log.WithField("project", project.Name).Infoln("Pause expired. Backups resumed.")
+		project.Resume()
+	}
+
+	for i := range project.Backups {
+		if execution, ok := c.executions[project.Backups[i].Checksum]; ok {
+			project.Backups[i].LastExecution = execution
+		}
+	}
+
+	for _, run := range c.runs {
+		project.AddRun(run)
+	}
+
+	if c.skipped {
+		project.SkipNext = false
+	}
+
+	if c.restoreTest != nil {
+		project.LastRestoreTest = c.restoreTest
+	}
 }
 
-func PerformStandaloneBackup(ctx context.Context, projectName string) (*backr.UploadedArchiveInfo, error) {
+// PerformStandaloneBackup executes immediately a backup of a project, without updating its schedule.
+// The execution is recorded in the runs of the project.
+func PerformStandaloneBackup(ctx context.Context, projectName string, options archive.Options) (*backr.UploadedArchiveInfo, error) {
 	opts, ok := backr.SettingsFromContext(ctx)
 	if !ok {
 		return nil, fmt.Errorf("Unable to get options from context")
 	}
 
-	// get a state storage
-	stateStorage, err := state.GetStorage(opts)
-	if err != nil {
-		return nil, fmt.Errorf("Unable to connect to state storage: %v", err)
-	}
-
-	project, err := stateStorage.GetProject(ctx, projectName)
+	project, err := getProject(ctx, projectName)
 	if err != nil {
-		return nil, fmt.Errorf("Unable to fetch project from state storage: %v", err)
+		return nil, err
 	}
-
-	if project == nil {
-		return nil, fmt.Errorf("Project not found")
+	if len(project.Conflicts) > 0 {
+		return nil, fmt.Errorf("The project name is declared by several backup.yml files: %s", strings.Join(project.Conflicts, ", "))
 	}
 
 	standaloneBackup := backr.Backup{
 		BackupSpec: backr.BackupSpec{
 			MinAge: 1,
+			TTL:    project.MaxTTL(),
 		},
 	}
 
-	info, err := archive.ExecuteBackup(*project, standaloneBackup, true, opts)
+	if opts.DryRun {
+		plan := archive.Plan(*project, opts)
+
+		log.WithFields(logrus.Fields{
+			"project": project.Name,
+			"command": plan.Command,
+			"object":  plan.Object,
+		}).Infoln("Dry run: backup would be executed")
+
+		return &backr.UploadedArchiveInfo{Name: plan.Object}, nil
+	}
+
+	backupCtx, release, err := acquireProject(ctx, project.Name, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	info, run, err := executeBackup(backupCtx, *project, standaloneBackup, options, opts)
+
+	// keep the run in the history of the project
+	run.Manual = true
+	persistCtx, cancel := persistContext(ctx)
+	saveErr := updateProject(persistCtx, projectName, func(project *backr.Project) {
+		run = project.AddRun(run)
+	})
+	cancel()
+	if saveErr != nil {
+		log.WithFields(logrus.Fields{
+			"project": projectName,
+			"err":     saveErr,
+		}).Errorln("Unable to save the run into state storage")
+	}
+
 	if err != nil {
 		return nil, fmt.Errorf("Backup execution error: %v", err)
 	}
@@ -149,11 +366,16 @@ func PerformStandaloneBackup(ctx context.Context, projectName string) (*backr.Up
 	return info, nil
 }
 
-func backupIsNeeded(backup backr.Backup, opts backr.Settings) bool {
-	nextBackupTime := backup.GetNextBackupTime(opts.TimeSpec, opts.StartupTime)
+func backupIsNeeded(backup backr.Backup, timeSpec backr.BackupTimeSpec, opts backr.Settings) bool {
+	nextBackupTime := backup.GetNextBackupTime(timeSpec, opts.StartupTime)
 	now := time.Now()
 
-	log.WithFields(log.Fields{"next": nextBackupTime, "compare_to": now}).Debugln("Comparing dates to check if backup is needed...")
+	log.WithFields(logrus.Fields{"next": nextBackupTime, "compare_to": now}).Debugln("Comparing dates to check if backup is needed...")
+
+	// a late backup waits for the next opening of the window
+	if timeSpec.Window != nil && !backup.IgnoreStartupTime && !timeSpec.Window.Contains(now, timeSpec.GetLocation()) {
+		return false
+	}
 
 	if nextBackupTime.Before(now) || nextBackupTime.Equal(now) {
 		return true
@@ -161,3 +383,12 @@ func backupIsNeeded(backup backr.Backup, opts backr.Settings) bool {
 
 	return false
 }
+
+// windowContext returns a context cancelled at the end of the current backup window, if the window requires it
+func windowContext(ctx context.Context, backup backr.Backup, timeSpec backr.BackupTimeSpec) (context.Context, context.CancelFunc) {
+	if timeSpec.Window == nil || !timeSpec.Window.CancelAtEnd || backup.IgnoreStartupTime {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithDeadline(ctx, timeSpec.Window.EndOf(time.Now(), timeSpec.GetLocation()))
+}
@@ -0,0 +1,111 @@
+package tasks
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+	"webup/backr"
+	"webup/backr/state"
+
+	"github.com/sirupsen/logrus"
+)
+
+// leaseTTL is the duration of the project leases: an instance stopped abruptly blocks its projects for this duration at most
+const leaseTTL = 2 * time.Minute
+
+// holderName identifies this instance in the leases
+var holderName = func() string {
+	host, _ := os.Hostname()
+	return fmt.Sprintf("%s:%d", host, os.Getpid())
+}()
+
+// acquireProject takes the lease of a project, so that no other instance sharing the state storage works on it,
+// and renews it until the returned release function is called. The returned context is cancelled if the lease is lost.
+func acquireProject(ctx context.Context, name string, opts backr.Settings) (context.Context, func(), error) {
+	locker, err := state.GetLocker(opts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	lease, err := locker.Acquire(ctx, name, holderName, leaseTTL)
+	if err == backr.ErrLeaseHeld {
+		return nil, nil, fmt.Errorf("Project locked by %s until %s: %w", lease.Holder, lease.ExpiresAt.Format(time.RFC3339), err)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("Unable to acquire the project lease: %v", err)
+	}
+
+	leaseCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		ticker := time.NewTicker(leaseTTL / 3)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+
+			renewed, err := locker.Renew(context.Background(), lease, leaseTTL)
+			if err == nil {
+				lease = renewed
+				continue
+			}
+
+			logEntry := log.WithFields(logrus.Fields{
+				"project": name,
+				"err":     err,
+			})
+
+			// another instance may take over the project once the lease is expired
+			if err == backr.ErrLeaseLost || !lease.IsValid(time.Now()) {
+				logEntry.Errorln("Project lease lost. Cancelling.")
+				cancel()
+				return
+			}
+
+			logEntry.Warnln("Unable to renew the project lease")
+		}
+	}()
+
+	release := func() {
+		close(done)
+		wg.Wait()
+		cancel()
+
+		if err := locker.Release(context.Background(), lease); err != nil {
+			log.WithFields(logrus.Fields{
+				"project": name,
+				"err":     err,
+			}).Warnln("Unable to release the project lease")
+		}
+	}
+
+	return leaseCtx, release, nil
+}
+
+// projectIsDue returns true if a backup or a restore drill of a project must be executed
+func projectIsDue(project backr.Project, timeSpec backr.BackupTimeSpec, opts backr.Settings) bool {
+	for _, backup := range project.Backups {
+		if backupIsNeeded(backup, timeSpec, opts) {
+			return true
+		}
+	}
+
+	if project.RestoreTest == nil || opts.S3 == nil || time.Now().Before(project.NextRestoreTest()) {
+		return false
+	}
+
+	// the drill is skipped until the project has an archive to restore
+	_, ok := latestArchive(project)
+	return ok
+}
@@ -0,0 +1,33 @@
+package tasks
+
+import (
+	"testing"
+	"webup/backr"
+)
+
+func TestProjectIsDueForRestoreTest(t *testing.T) {
+	settings := backr.NewDefaultSettings()
+	settings.S3 = &backr.S3Settings{Bucket: "bucket"}
+
+	tests := []struct {
+		name     string
+		runs     []backr.Run
+		expected bool
+	}{
+		{"no run yet", nil, false},
+		{"no archived run", []backr.Run{{ID: 1, Success: false}}, false},
+		{"archived run", []backr.Run{{ID: 1, Success: true, Archive: "project/archive.tar.gz"}}, true},
+	}
+
+	for _, test := range tests {
+		project := backr.Project{
+			Name:        "project",
+			RestoreTest: &backr.RestoreTestSpec{Command: []string{"true"}},
+			Runs:        test.runs,
+		}
+
+		if due := projectIsDue(project, backr.BackupTimeSpec{}, settings); due != test.expected {
+			t.Errorf("%s: expected the project to be due: %v, got %v", test.name, test.expected, due)
+		}
+	}
+}
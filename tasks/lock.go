@@ -0,0 +1,75 @@
+package tasks
+
+import (
+	"context"
+	"fmt"
+	"webup/backr"
+	"webup/backr/s3"
+	"webup/backr/state"
+
+	"github.com/sirupsen/logrus"
+)
+
+// CheckObjectLock ensures that Object Lock is enabled on the bucket of each destination, if archives must be locked.
+// An unreachable destination is only logged, as it may be available when the backups are executed.
+func CheckObjectLock(ctx context.Context) error {
+	opts, ok := backr.SettingsFromContext(ctx)
+	if !ok {
+		return fmt.Errorf("Unable to get options from context")
+	}
+
+	if opts.S3 == nil {
+		return nil
+	}
+
+	locked, err := lockRequired(ctx, opts)
+	if err != nil {
+		return err
+	}
+
+	if !locked {
+		return nil
+	}
+
+	for _, destination := range opts.GetDestinations() {
+		enabled, err := s3.CheckObjectLock(destination)
+		if err != nil {
+			log.WithFields(logrus.Fields{
+				"destination": destination.Name,
+				"err":         err,
+			}).Warnln("Unable to check the Object Lock configuration of a destination")
+			continue
+		}
+
+		if !enabled {
+			return fmt.Errorf("Object Lock is not enabled on the bucket '%s' of the destination '%s'", destination.Bucket, destination.Name)
+		}
+	}
+
+	return nil
+}
+
+// lockRequired returns true if the daemon or a project locks the archives
+func lockRequired(ctx context.Context, opts backr.Settings) (bool, error) {
+	if opts.S3Objects.IsLocked() {
+		return true, nil
+	}
+
+	stateStorage, err := state.GetStorage(opts)
+	if err != nil {
+		return false, fmt.Errorf("Unable to connect to state storage: %v", err)
+	}
+
+	projects, err := stateStorage.ConfiguredProjects(ctx)
+	if err != nil {
+		return false, fmt.Errorf("Unable to get configured projects from state storage: %v", err)
+	}
+
+	for _, project := range projects {
+		if project.ObjectSettings(opts.S3Objects).IsLocked() {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
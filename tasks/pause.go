@@ -0,0 +1,82 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+	"webup/backr"
+	"webup/backr/state"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ErrProjectNotFound is returned when a project is not configured in the state storage
+var ErrProjectNotFound = errors.New("Project not found")
+
+// PauseProject suspends the scheduled backups of a project. A zero until pauses it indefinitely.
+func PauseProject(ctx context.Context, name string, until time.Time) error {
+	return updateProject(ctx, name, func(project *backr.Project) {
+		project.Pause(until)
+
+		log.WithFields(logrus.Fields{
+			"project": name,
+			"until":   until,
+		}).Infoln("Project paused")
+	})
+}
+
+// ResumeProject restores the scheduled backups of a paused project
+func ResumeProject(ctx context.Context, name string) error {
+	return updateProject(ctx, name, func(project *backr.Project) {
+		project.Resume()
+
+		log.WithField("project", name).Infoln("Project resumed")
+	})
+}
+
+// SkipNextBackup skips the next scheduled backup of a project
+func SkipNextBackup(ctx context.Context, name string) error {
+	return updateProject(ctx, name, func(project *backr.Project) {
+		project.SkipNext = true
+
+		log.WithField("project", name).Infoln("Next backup will be skipped")
+	})
+}
+
+// persistTimeout bounds the saving of the results of a task
+const persistTimeout = 30 * time.Second
+
+// persistContext returns a context to save the results of a task: it carries the settings of ctx, but is not cancelled with it,
+// so that the results of the backups cancelled when the daemon stops are saved anyway
+func persistContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	opts, _ := backr.SettingsFromContext(ctx)
+	persistCtx, cancel := context.WithTimeout(context.Background(), persistTimeout)
+
+	return backr.NewContextWithSettings(persistCtx, opts), cancel
+}
+
+func updateProject(ctx context.Context, name string, update func(project *backr.Project)) error {
+	opts, ok := backr.SettingsFromContext(ctx)
+	if !ok {
+		return fmt.Errorf("Unable to get options from context")
+	}
+
+	// get a state storage
+	stateStorage, err := state.GetStorage(opts)
+	if err != nil {
+		return fmt.Errorf("Unable to connect to state storage: %v", err)
+	}
+
+	// the storage applies the update atomically: a concurrent update of the project is never overwritten
+	project, err := stateStorage.UpdateProject(ctx, name, update)
+	if err != nil {
+		return fmt.Errorf("Unable to update state in state storage: %v", err)
+	}
+
+	if project == nil {
+		return ErrProjectNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,113 @@
+package tasks
+
+import (
+	"context"
+	"fmt"
+	"time"
+	"webup/backr"
+	"webup/backr/s3"
+
+	"github.com/sirupsen/logrus"
+)
+
+// PruneProject applies the retention policy of a project to its archives.
+// Nothing is deleted if dryRun is true, or in dry-run mode: the returned decisions only tell what would be kept and why.
+func PruneProject(ctx context.Context, projectName string, dryRun bool) ([]backr.PruneDecision, error) {
+	opts, ok := backr.SettingsFromContext(ctx)
+	if !ok {
+		return nil, fmt.Errorf("Unable to get options from context")
+	}
+
+	project, err := getProject(ctx, projectName)
+	if err != nil {
+		return nil, err
+	}
+
+	return pruneArchives(*project, opts, dryRun || opts.DryRun)
+}
+
+func pruneArchives(project backr.Project, opts backr.Settings, dryRun bool) ([]backr.PruneDecision, error) {
+	if project.Retention == nil {
+		return nil, fmt.Errorf("No retention policy configured for this project")
+	}
+
+	if opts.S3 == nil {
+		return nil, fmt.Errorf("S3 is not configured")
+	}
+
+	// each destination holds its own copy of the archives
+	decisions := []backr.PruneDecision{}
+	for _, destination := range opts.GetDestinations() {
+		destinationDecisions, err := pruneDestination(project, destination, opts, dryRun)
+		decisions = append(decisions, destinationDecisions...)
+		if err != nil {
+			return decisions, fmt.Errorf("%s: %w", destination.Name, err)
+		}
+	}
+
+	return decisions, nil
+}
+
+func pruneDestination(project backr.Project, destination backr.S3Settings, opts backr.Settings, dryRun bool) ([]backr.PruneDecision, error) {
+	archives, err := s3.ListArchives(project, project.ObjectSettings(opts.S3Objects), destination)
+	if err != nil {
+		return nil, err
+	}
+
+	decisions := project.Retention.Plan(archives, project.TimeSpec(opts.TimeSpec).GetLocation())
+	locked := project.ObjectSettings(opts.S3Objects).IsLocked()
+	for i := range decisions {
+		decisions[i].Destination = destination.Name
+
+		// the archives still locked can not be deleted
+		if !decisions[i].Keep && locked {
+			if err := keepLockedArchive(&decisions[i], destination); err != nil {
+				return decisions, err
+			}
+		}
+	}
+
+	if dryRun {
+		return decisions, nil
+	}
+
+	for i := range decisions {
+		if decisions[i].Keep {
+			continue
+		}
+
+		err := s3.DeleteArchive(decisions[i].Archive.Name, destination)
+		if err != nil {
+			return decisions, err
+		}
+		decisions[i].Deleted = true
+
+		log.WithFields(logrus.Fields{
+			"project":     project.Name,
+			"destination": destination.Name,
+			"file":        decisions[i].Archive.Name,
+		}).Infoln("Archive pruned")
+	}
+
+	return decisions, nil
+}
+
+// keepLockedArchive keeps an archive protected by Object Lock
+func keepLockedArchive(decision *backr.PruneDecision, destination backr.S3Settings) error {
+	retainUntil, legalHold, err := s3.ArchiveLock(decision.Archive.Name, destination)
+	if err != nil {
+		return err
+	}
+
+	if retainUntil.After(time.Now()) {
+		decision.Keep = true
+		decision.Reasons = append(decision.Reasons, "locked until "+retainUntil.Format(time.RFC3339))
+	}
+
+	if legalHold {
+		decision.Keep = true
+		decision.Reasons = append(decision.Reasons, "legal hold")
+	}
+
+	return nil
+}
@@ -0,0 +1,134 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+	"webup/backr"
+	"webup/backr/archive"
+	"webup/backr/state"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ErrRunNotFound is returned when a run is not in the history of a project
+var ErrRunNotFound = fmt.Errorf("Run not found")
+
+// executeBackup executes a backup and returns the run describing the execution, with the captured output
+func executeBackup(ctx context.Context, project backr.Project, backup backr.Backup, options archive.Options, opts backr.Settings) (*backr.UploadedArchiveInfo, backr.Run, error) {
+	output := archive.NewOutputBuffer(backr.MaxRunOutputSize)
+	if options.Output != nil {
+		options.Output = io.MultiWriter(output, options.Output)
+	} else {
+		options.Output = output
+	}
+
+	run := backr.Run{StartedAt: time.Now()}
+
+	info, err := archive.ExecuteBackup(ctx, project, backup, options, opts)
+
+	run.FinishedAt = time.Now()
+	run.Output = output.String()
+
+	// the output of the archiver tells why it failed
+	var executionErr backr.ExecutionError
+	if errors.As(err, &executionErr) {
+		executionErr.Output = run.Output
+		err = executionErr
+	}
+
+	if err != nil {
+		run.Error = err.Error()
+	} else {
+		run.Success = true
+	}
+
+	// an archive may be available on some destinations, even if the execution failed
+	if info != nil {
+		run.Destinations = info.Destinations
+		if err == nil || run.HasReplica() {
+			run.Archive = info.Name
+		}
+		run.Size = info.Size
+		run.SizeAnomaly = info.SizeAnomaly
+		reportArchiveSize(project, run)
+	}
+
+	return info, run, err
+}
+
+// GetRuns returns the history of the executions of a project, without their output
+func GetRuns(ctx context.Context, projectName string) ([]backr.Run, error) {
+	project, err := getProject(ctx, projectName)
+	if err != nil {
+		return nil, err
+	}
+
+	runs := []backr.Run{}
+	for _, run := range project.Runs {
+		run.Output = ""
+		runs = append(runs, run)
+	}
+
+	return runs, nil
+}
+
+// GetRun returns an execution of a project, with its output. A zero id returns the last run.
+func GetRun(ctx context.Context, projectName string, id int) (backr.Run, error) {
+	project, err := getProject(ctx, projectName)
+	if err != nil {
+		return backr.Run{}, err
+	}
+
+	run, ok := project.GetRun(id)
+	if !ok {
+		return backr.Run{}, ErrRunNotFound
+	}
+
+	return run, nil
+}
+
+func getProject(ctx context.Context, name string) (*backr.Project, error) {
+	opts, ok := backr.SettingsFromContext(ctx)
+	if !ok {
+		return nil, fmt.Errorf("Unable to get options from context")
+	}
+
+	// get a state storage
+	stateStorage, err := state.GetStorage(opts)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to connect to state storage: %v", err)
+	}
+
+	project, err := stateStorage.GetProject(ctx, name)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to fetch project from state storage: %v", err)
+	}
+
+	if project == nil {
+		return nil, ErrProjectNotFound
+	}
+
+	return project, nil
+}
+
+// reportArchiveSize logs the abnormal size of the archive of a run, as an error if the size check fails the backups
+func reportArchiveSize(project backr.Project, run backr.Run) {
+	if run.SizeAnomaly == "" {
+		return
+	}
+
+	logEntry := log.WithFields(logrus.Fields{
+		"project": project.Name,
+		"size":    run.Size,
+		"archive": run.Archive,
+	})
+
+	if project.GetSizeCheck().Fails() {
+		logEntry.Errorln("Abnormal archive size:", run.SizeAnomaly)
+	} else {
+		logEntry.Warnln("Abnormal archive size:", run.SizeAnomaly)
+	}
+}
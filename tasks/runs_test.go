@@ -0,0 +1,80 @@
+package tasks
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"webup/backr"
+	"webup/backr/archive"
+	"webup/backr/s3/s3test"
+)
+
+func TestExecuteBackupChecksArchiveSize(t *testing.T) {
+	// the archives are written into ._tmp, under the working directory
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	// the previous archives were about 1 KB, the new one is 6 bytes
+	previous := []backr.Run{}
+	for id := 1; id <= 3; id++ {
+		previous = append(previous, backr.Run{ID: id, Success: true, Archive: "project/previous", Size: 1000})
+	}
+
+	tests := []struct {
+		name            string
+		sizeCheck       *backr.SizeCheckSpec
+		expectedSuccess bool
+		expectedUpload  bool
+	}{
+		{"default check only reports the anomaly", nil, true, true},
+		{"failing check does not upload the archive", &backr.SizeCheckSpec{MaxDecrease: 50, Action: backr.SizeCheckFail}, false, false},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			standIn := s3test.NewStandIn(t)
+			destination := standIn.Settings()
+			settings := backr.NewDefaultSettings()
+			settings.S3 = &destination
+
+			project := backr.Project{
+				Name:      "project",
+				Dir:       t.TempDir(),
+				Archiver:  backr.Archiver{Type: "stdout", OutputFileExtension: "txt", Command: []string{"echo", "small"}},
+				Runs:      previous,
+				SizeCheck: test.sizeCheck,
+			}
+
+			_, run, err := executeBackup(context.Background(), project, backr.Backup{}, archive.Options{}, settings)
+			if test.expectedSuccess && err != nil {
+				t.Fatalf("executeBackup: %v", err)
+			}
+
+			if run.Success != test.expectedSuccess {
+				t.Errorf("expected a successful run: %v, got %v (%s)", test.expectedSuccess, run.Success, run.Error)
+			}
+			if run.Size != 6 {
+				t.Errorf("expected an archive of 6 bytes, got %d", run.Size)
+			}
+			if !strings.Contains(run.SizeAnomaly, "under the baseline") {
+				t.Errorf("expected the size anomaly of the run, got %q", run.SizeAnomaly)
+			}
+
+			uploaded := false
+			if run.Archive != "" {
+				_, uploaded = standIn.Object("bucket/" + run.Archive)
+			}
+			if uploaded != test.expectedUpload {
+				t.Errorf("expected the archive to be uploaded: %v, got %v", test.expectedUpload, uploaded)
+			}
+		})
+	}
+}
@@ -0,0 +1,142 @@
+package tasks
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+	"webup/backr"
+	"webup/backr/state"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ExportState returns every project of the state storage, sorted by name
+func ExportState(ctx context.Context) (backr.StateExport, error) {
+	opts, ok := backr.SettingsFromContext(ctx)
+	if !ok {
+		return backr.StateExport{}, fmt.Errorf("Unable to get options from context")
+	}
+
+	stateStorage, err := state.GetStorage(opts)
+	if err != nil {
+		return backr.StateExport{}, fmt.Errorf("Unable to connect to state storage: %v", err)
+	}
+
+	projects, err := stateStorage.ConfiguredProjects(ctx)
+	if err != nil {
+		return backr.StateExport{}, fmt.Errorf("Unable to fetch projects from state storage: %v", err)
+	}
+
+	export := backr.StateExport{
+		ExportedAt: time.Now(),
+		Projects:   []backr.Project{},
+	}
+	for _, project := range projects {
+		export.Projects = append(export.Projects, project)
+	}
+	sort.Slice(export.Projects, func(i, j int) bool {
+		return export.Projects[i].Name < export.Projects[j].Name
+	})
+
+	return export, nil
+}
+
+// ImportState stores the projects of an export into the state storage.
+// The existing projects are kept or replaced depending on mode.
+func ImportState(ctx context.Context, export backr.StateExport, mode backr.ImportMode) (backr.ImportReport, error) {
+	report := backr.ImportReport{}
+
+	if mode != backr.ImportMerge && mode != backr.ImportOverwrite {
+		return report, fmt.Errorf("Import mode must be 'merge' or 'overwrite', not '%s'", mode)
+	}
+
+	opts, ok := backr.SettingsFromContext(ctx)
+	if !ok {
+		return report, fmt.Errorf("Unable to get options from context")
+	}
+
+	stateStorage, err := state.GetStorage(opts)
+	if err != nil {
+		return report, fmt.Errorf("Unable to connect to state storage: %v", err)
+	}
+
+	existingProjects, err := stateStorage.ConfiguredProjects(ctx)
+	if err != nil {
+		return report, fmt.Errorf("Unable to fetch projects from state storage: %v", err)
+	}
+
+	for _, project := range export.Projects {
+		if project.Name == "" {
+			return report, fmt.Errorf("Unable to import a project without name")
+		}
+
+		logEntry := log.WithField("project", project.Name)
+
+		_, exists := existingProjects[project.Name]
+		if exists && mode == backr.ImportMerge {
+			logEntry.Infoln("Project already exists. Skipping.")
+			report.Skipped++
+			continue
+		}
+
+		if err := stateStorage.SaveProject(ctx, project); err != nil {
+			return report, fmt.Errorf("Unable to save the project '%s' into state storage: %v", project.Name, err)
+		}
+
+		if exists {
+			logEntry.Infoln("Project replaced.")
+			report.Replaced++
+		} else {
+			logEntry.Infoln("Project imported.")
+			report.Created++
+		}
+	}
+
+	log.WithFields(logrus.Fields{
+		"created":  report.Created,
+		"replaced": report.Replaced,
+		"skipped":  report.Skipped,
+	}).Infoln("State imported")
+
+	return report, nil
+}
+
+// GetProjectState returns a project as stored in the state storage
+func GetProjectState(ctx context.Context, name string) (*backr.Project, error) {
+	return getProject(ctx, name)
+}
+
+// ForgetProject removes a project from the state storage, leaving its archives on the destinations.
+// A project still declared by a backup.yml file is created again by the next state update.
+func ForgetProject(ctx context.Context, name string) error {
+	opts, ok := backr.SettingsFromContext(ctx)
+	if !ok {
+		return fmt.Errorf("Unable to get options from context")
+	}
+
+	stateStorage, err := state.GetStorage(opts)
+	if err != nil {
+		return fmt.Errorf("Unable to connect to state storage: %v", err)
+	}
+
+	project, err := getProject(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	// a running backup would save the project again
+	_, release, err := acquireProject(ctx, name, opts)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	if err := stateStorage.DeleteProject(ctx, *project); err != nil {
+		return fmt.Errorf("Unable to delete the project from state storage: %v", err)
+	}
+
+	log.WithField("project", name).Infoln("Project removed from the state.")
+
+	return nil
+}
@@ -3,6 +3,7 @@ package tasks
 import (
 	"context"
 	"fmt"
+	"time"
 	"webup/backr"
 	"webup/backr/state"
 )
@@ -28,27 +29,112 @@ func GetStatus(ctx context.Context) (backr.Status, error) {
 		return status, err
 	}
 
+	// the leases are informative: they are not available with every state storage
+	leases := map[string]backr.Lease{}
+	if locker, err := state.GetLocker(opts); err == nil {
+		if current, err := locker.Leases(ctx); err == nil {
+			leases = current
+		}
+	}
+
 	configuredProjects := []backr.ProjectStatus{}
+	now := time.Now()
 
 	for _, project := range projects {
 		configuredBackups := []backr.BackupStatus{}
+		paused := project.IsPaused(now)
+		timeSpec := project.TimeSpec(opts.TimeSpec)
+		location := timeSpec.GetLocation()
 
 		for _, backup := range project.Backups {
 
 			status := backr.BackupStatus{
 				MinAge:        backup.MinAge,
 				PeriodUnit:    backup.PeriodUnit,
-				LastExecution: backup.LastExecution,
-				NextExecution: backup.GetNextBackupTime(opts.TimeSpec, opts.StartupTime),
-				IsHealthy:     backup.GetHealth(opts.TimeSpec, opts.StartupTime),
+				LastExecution: inLocation(backup.LastExecution, location),
+				NextExecution: backup.GetNextBackupTime(timeSpec, opts.StartupTime),
+				// a paused project is not considered as late
+				IsHealthy: paused || backup.GetHealth(timeSpec, opts.StartupTime),
 			}
 
 			configuredBackups = append(configuredBackups, status)
 		}
 
-		projectStatus := backr.ProjectStatus{Name: project.Name, ConfiguredBackups: configuredBackups}
+		projectStatus := backr.ProjectStatus{
+			Name:              project.Name,
+			ConfiguredBackups: configuredBackups,
+			Timezone:          location.String(),
+			Paused:            paused,
+			SkipNext:          project.SkipNext,
+			Conflicts:         project.Conflicts,
+		}
+		if timeSpec.Window != nil {
+			projectStatus.Window = timeSpec.Window.String()
+		}
+		if project.RestoreTest != nil {
+			projectStatus.RestoreTest = restoreTestStatus(project, location)
+		}
+		projectStatus.Size = sizeStatus(project)
+		if lease, ok := leases[project.Name]; ok {
+			projectStatus.Lease = &backr.LeaseStatus{
+				Holder:     lease.Holder,
+				AcquiredAt: lease.AcquiredAt.In(location),
+				ExpiresAt:  lease.ExpiresAt.In(location),
+			}
+		}
+		if paused && !project.PausedUntil.IsZero() {
+			pausedUntil := project.PausedUntil.In(location)
+			projectStatus.PausedUntil = &pausedUntil
+		}
+
 		configuredProjects = append(configuredProjects, projectStatus)
 	}
 
 	return backr.Status{ConfiguredProjects: configuredProjects}, nil
 }
+
+// restoreTestStatus returns the state of the restore drills of a project. A drill not executed yet is not considered as a failure.
+func restoreTestStatus(project backr.Project, location *time.Location) *backr.RestoreTestStatus {
+	status := &backr.RestoreTestStatus{
+		NextExecution: inLocation(project.NextRestoreTest(), location),
+		IsHealthy:     true,
+	}
+
+	if last := project.LastRestoreTest; last != nil {
+		lastExecution := last.StartedAt.In(location)
+		status.LastExecution = &lastExecution
+		status.Success = last.Success
+		status.Error = last.Error
+		status.Archive = last.Archive
+		status.IsHealthy = last.Success
+	}
+
+	return status
+}
+
+// sizeStatus returns the size of the last archive of a project, nil if no archive has been produced yet
+func sizeStatus(project backr.Project) *backr.SizeStatus {
+	for i := len(project.Runs) - 1; i >= 0; i-- {
+		run := project.Runs[i]
+		if run.Size == 0 {
+			continue
+		}
+
+		return &backr.SizeStatus{
+			LastSize:  run.Size,
+			Baseline:  project.GetSizeCheck().BaselineSize(project.Runs[:i]),
+			Anomaly:   run.SizeAnomaly,
+			IsHealthy: run.SizeAnomaly == "",
+		}
+	}
+
+	return nil
+}
+
+// inLocation converts a time to a location, so that it is rendered with the offset of the project time zone
+func inLocation(t time.Time, location *time.Location) time.Time {
+	if t.IsZero() {
+		return t
+	}
+	return t.In(location)
+}
@@ -2,13 +2,15 @@ package tasks
 
 import (
 	"context"
+	"encoding/json"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"webup/backr"
 	"webup/backr/state"
 
-	log "github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus"
 )
 
 // UpdateStateFromSpec runs before each backup to fetch the backup.yml files inside watched directories and update the state
@@ -25,18 +27,19 @@ func UpdateStateFromSpec(ctx context.Context) {
 	// get a state storage
 	stateStorage, err := state.GetStorage(opts)
 	if err != nil {
-		log.WithFields(log.Fields{
+		log.WithFields(logrus.Fields{
 			"err": err,
 		}).Errorln("Unable to connect to state storage")
 		return
 	}
 
-	configFiles := []string{}
+	configFiles := []specFile{}
+	currentWatchDir := ""
 
 	walkFunc := func(path string, info os.FileInfo, err error) error {
 		filename := info.Name()
 		if !info.IsDir() && filename == "backup.yml" {
-			configFiles = append(configFiles, path)
+			configFiles = append(configFiles, specFile{path: path, watchDir: currentWatchDir})
 			return filepath.SkipDir
 		}
 
@@ -55,7 +58,7 @@ func UpdateStateFromSpec(ctx context.Context) {
 	for _, dir := range opts.WatchDirs {
 		fileinfo, err := os.Stat(dir)
 		if err != nil {
-			log.WithFields(log.Fields{
+			log.WithFields(logrus.Fields{
 				"path": dir,
 				"err":  err,
 			}).Errorln("Unable to get file info")
@@ -64,15 +67,16 @@ func UpdateStateFromSpec(ctx context.Context) {
 
 		// handle only directories
 		if !fileinfo.IsDir() {
-			log.WithFields(log.Fields{
+			log.WithFields(logrus.Fields{
 				"path": dir,
 			}).Warnln("Not a directory. Skipped.")
 			continue
 		}
 
+		currentWatchDir = dir
 		filepath.Walk(dir, walkFunc)
 		// if err != nil {
-		// 	log.WithFields(log.Fields{
+		// 	log.WithFields(logrus.Fields{
 		// 		"path": dir,
 		// 	}).Infoln("Skipping directory")
 		// 	continue
@@ -86,77 +90,142 @@ func UpdateStateFromSpec(ctx context.Context) {
 	// fetch already configured projects before executing
 	existingProjects, err := stateStorage.ConfiguredProjects(ctx)
 	if err != nil {
-		log.WithFields(log.Fields{
+		log.WithFields(logrus.Fields{
 			"err": err,
 		}).Errorln("Unable to get existing projects from state storage")
 		return
 	}
 
+	// the projects are keyed by name: the files declaring the same name are kept aside
+	declaredSpecs := map[string][]specFile{}
+
 	for _, file := range configFiles {
 
-		log.WithFields(log.Fields{
-			"file": file,
+		log.WithFields(logrus.Fields{
+			"file": file.path,
 		}).Debugln("Parsing spec file")
 
-		parsedSpec, err := parseSpecFile(file)
+		parsedSpec, err := parseSpecFile(file.path)
 		if err != nil {
-			log.WithFields(log.Fields{
-				"file": file,
+			log.WithFields(logrus.Fields{
+				"file": file.path,
 				"err":  err,
 			}).Errorln("Unable to parse backup.yml file")
 			continue
 		}
 
 		if err := parsedSpec.IsValid(); err != nil {
-			log.WithFields(log.Fields{
-				"file": file,
+			log.WithFields(logrus.Fields{
+				"file": file.path,
 				"err":  err,
 			}).Errorln("The backup.yml file is not valid")
 			continue
 		}
 
+		file.name = parsedSpec.Name
+		parsedSpec.Name = projectName(parsedSpec.Name, file.watchDir, opts.ProjectNamespace)
+		file.spec = parsedSpec
+		declaredSpecs[parsedSpec.Name] = append(declaredSpecs[parsedSpec.Name], file)
+	}
+
+	// renaming the projects would drop their state, and leave their archives under their previous names without pruning
+	if renamed := renamedProjects(declaredSpecs, existingProjects, opts.ProjectNamespace); len(renamed) > 0 {
+		for name, previous := range renamed {
+			log.WithFields(logrus.Fields{
+				"project":       name,
+				"previous_name": previous,
+			}).Errorln("The project namespace renames a project which has archives under its previous name.")
+		}
+		log.Errorln("The project namespace changed: the state is not updated, the projects keep their previous names. " +
+			"Restore the previous namespace, or remove the previous projects from the state ('backr state forget') once their archives are handled.")
+		return
+	}
+
+	for name, files := range declaredSpecs {
+		parsedSpec := files[0].spec
+		dir, _ := filepath.Abs(filepath.Dir(files[0].path))
+
 		// keep the parsed config for delete handling, later (see below)
-		configuredBackups[parsedSpec.Name] = parsedSpec
+		configuredBackups[name] = parsedSpec
+
+		var conflicts []string
+		if len(files) > 1 {
+			for _, file := range files {
+				path, _ := filepath.Abs(file.path)
+				conflicts = append(conflicts, path)
+			}
+			sort.Strings(conflicts)
 
-		var project backr.Project
+			log.WithFields(logrus.Fields{
+				"project": name,
+				"files":   strings.Join(conflicts, ", "),
+			}).Errorln("Several backup.yml files declare the same project name. The project is not scheduled until they are renamed (or until --project-namespace=watch-dir separates them, if they are in different watched directories).")
+		}
 
 		// trying to find the existing project
-		project, ok := existingProjects[parsedSpec.Name]
+		existing, ok := existingProjects[name]
+
 		if !ok {
-			log.WithFields(log.Fields{
-				"name": parsedSpec.Name,
-			}).Infoln("Backup config not found in current state. Create it.")
-
-			project = backr.NewProject(parsedSpec)
-
-		} else {
-			// if _, ok := (*running)[project.Name]; ok {
-			// 	log.WithFields(log.Fields{
-			// 		"name": project.Name,
-			// 	}).Infoln("Backup is currently running. Delay the update to next iteration.")
-			// 	continue
-			// }
-
-			report := project.Update(parsedSpec)
-
-			// log only when a config has been updated
-			if report.Created > 0 || report.Deleted > 0 {
-				log.WithFields(log.Fields{
-					"name":      parsedSpec.Name,
-					"created":   report.Created,
-					"unchanged": report.Unchanged,
-					"deleted":   report.Deleted,
-				}).Infoln("Backup successfully configured")
+			// the state of a conflicting project is empty until the conflict is resolved
+			project := backr.Project{Name: name, Conflicts: conflicts}
+			if len(conflicts) == 0 {
+				log.WithFields(logrus.Fields{
+					"project": name,
+				}).Infoln("Backup config not found in current state. Create it.")
+
+				project = backr.NewProject(parsedSpec)
+				project.Dir = dir
 			}
+
+			if err := stateStorage.SaveProject(ctx, project); err != nil {
+				log.WithFields(logrus.Fields{
+					"err": err,
+				}).Errorln("Unable to save project into state storage")
+			}
+			continue
+		}
+
+		// update applies the spec to a project, keeping its state. Only the conflict is recorded for a conflicting project
+		update := func(project *backr.Project) backr.UpdateReport {
+			project.Conflicts = conflicts
+			if len(conflicts) > 0 {
+				return backr.UpdateReport{}
+			}
+
+			// set the directory of the config path
+			project.Dir = dir
+			return project.Update(parsedSpec)
 		}
 
-		// set the directory of the config path
-		project.Dir, _ = filepath.Abs(filepath.Dir(file))
+		before := projectState(existing)
+		report := update(&existing)
+		if projectState(existing) == before {
+			continue
+		}
+
+		if len(conflicts) == 0 && len(existingProjects[name].Conflicts) > 0 {
+			log.WithFields(logrus.Fields{
+				"project": name,
+				"file":    files[0].path,
+			}).Infoln("Project name conflict resolved. Backups scheduled again.")
+		}
+
+		// log only when a config has been updated
+		if report.Created > 0 || report.Deleted > 0 {
+			log.WithFields(logrus.Fields{
+				"project":   name,
+				"created":   report.Created,
+				"unchanged": report.Unchanged,
+				"deleted":   report.Deleted,
+			}).Infoln("Backup successfully configured")
+		}
 
-		// save the configuration into state storage
-		err = stateStorage.SaveProject(ctx, project)
+		// the spec is applied to the current state, which may have changed since the projects were fetched
+		err = updateProject(ctx, name, func(project *backr.Project) {
+			update(project)
+		})
 		if err != nil {
-			log.WithFields(log.Fields{
+			log.WithFields(logrus.Fields{
 				"err": err,
 			}).Errorln("Unable to save project into state storage")
 		}
@@ -165,15 +234,15 @@ func UpdateStateFromSpec(ctx context.Context) {
 	// clean deleted configurations
 	for name, project := range existingProjects {
 		if _, ok := configuredBackups[name]; !ok {
-			log.WithFields(log.Fields{
-				"name": name,
+			log.WithFields(logrus.Fields{
+				"project": name,
 			}).Infoln("Backup config no longer exists. Remove it from the current state.")
 
 			err := stateStorage.DeleteProject(ctx, project)
 
 			if err != nil {
-				log.WithFields(log.Fields{
-					"name": name,
+				log.WithFields(logrus.Fields{
+					"project": name,
 				}).Errorln("Unable to delete project from the current state.")
 			}
 		}
@@ -182,3 +251,89 @@ func UpdateStateFromSpec(ctx context.Context) {
 	log.Debugln("State update done")
 
 }
+
+// projectState returns the state of a project as stored, to detect its changes
+func projectState(project backr.Project) string {
+	state, _ := json.Marshal(project)
+	return string(state)
+}
+
+// specFile is a backup.yml file found in a watched directory
+type specFile struct {
+	path     string
+	watchDir string
+	// name is the project name declared by the file, before the namespace is applied
+	name string
+	spec backr.ProjectBackupSpec
+}
+
+// renamedProjects returns the previous names of the declared projects, by name, which are only stored
+// under the name given by another namespace. The projects which never ran have no archive, and can be renamed.
+func renamedProjects(declaredSpecs map[string][]specFile, existingProjects map[string]backr.Project, namespace backr.ProjectNamespace) map[string]string {
+	renamed := map[string]string{}
+
+	for name, files := range declaredSpecs {
+		if _, ok := existingProjects[name]; ok {
+			continue
+		}
+
+		for _, file := range files {
+			dir, _ := filepath.Abs(filepath.Dir(file.path))
+			path, _ := filepath.Abs(file.path)
+
+			for _, other := range []backr.ProjectNamespace{backr.NamespaceNone, backr.NamespaceWatchDir, backr.NamespaceHostname} {
+				previous := projectName(file.name, file.watchDir, other)
+				if other == namespace || previous == name {
+					continue
+				}
+				if _, declared := declaredSpecs[previous]; declared {
+					continue
+				}
+
+				project, ok := existingProjects[previous]
+				if !ok || !hasArchives(project) {
+					continue
+				}
+				// the project was declared by this file, alone or in conflict with others
+				matches := project.Dir == dir
+				for _, conflict := range project.Conflicts {
+					matches = matches || conflict == path
+				}
+				if matches {
+					renamed[name] = previous
+				}
+			}
+		}
+	}
+
+	return renamed
+}
+
+// hasArchives returns true if a backup of the project has been executed, storing an archive under its name
+func hasArchives(project backr.Project) bool {
+	if len(project.Runs) > 0 {
+		return true
+	}
+
+	for _, backup := range project.Backups {
+		if !backup.LastExecution.IsZero() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// projectName returns the name of a project declared in a watched directory, prefixed according to the namespace setting
+func projectName(name string, watchDir string, namespace backr.ProjectNamespace) string {
+	switch namespace {
+	case backr.NamespaceWatchDir:
+		dir, _ := filepath.Abs(watchDir)
+		return filepath.Base(dir) + "." + name
+	case backr.NamespaceHostname:
+		host, _ := os.Hostname()
+		return strings.SplitN(host, ".", 2)[0] + "." + name
+	}
+
+	return name
+}
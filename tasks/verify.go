@@ -0,0 +1,131 @@
+package tasks
+
+import (
+	"context"
+	"fmt"
+	"webup/backr"
+	"webup/backr/s3"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ErrNoArchive is returned when a run has not produced any archive
+var ErrNoArchive = fmt.Errorf("No archive available")
+
+// ErrDestinationNotFound is returned when a destination is not configured
+var ErrDestinationNotFound = fmt.Errorf("Destination not found")
+
+// VerifyRun checks that the archive of a run is available on each destination, and matches its manifest. A zero id verifies the last run.
+func VerifyRun(ctx context.Context, projectName string, id int) ([]backr.VerifyResult, error) {
+	opts, project, run, err := getArchivedRun(ctx, projectName, id)
+	if err != nil {
+		return nil, err
+	}
+	objects := project.ObjectSettings(opts.S3Objects)
+
+	results := []backr.VerifyResult{}
+	for _, destination := range opts.GetDestinations() {
+		result := backr.VerifyResult{
+			Destination: destination.Name,
+			Archive:     run.Archive,
+		}
+
+		archive, err := s3.StatArchive(run.Archive, objects, destination)
+		if err != nil {
+			result.Error = err.Error()
+		} else {
+			result.Available = true
+			result.Size = archive.Size
+
+			// the archives uploaded by the previous versions have no manifest
+			result.Manifest, err = s3.GetManifest(ctx, run.Archive, objects, destination)
+			if err == nil && result.Manifest != nil {
+				err = result.Manifest.Describes(*archive)
+			}
+			if err != nil {
+				result.Error = err.Error()
+			}
+		}
+
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+// GetArchiveLocation returns a presigned URL to download the archive of a run, with the destination providing it and the manifest of the archive.
+// Without a destination, the first destination where the archive is available is used.
+func GetArchiveLocation(ctx context.Context, projectName string, id int, destinationName string) (*backr.ArchiveLocation, error) {
+	opts, project, run, err := getArchivedRun(ctx, projectName, id)
+	if err != nil {
+		return nil, err
+	}
+	objects := project.ObjectSettings(opts.S3Objects)
+
+	destinations := opts.GetDestinations()
+	if destinationName != "" {
+		destination, ok := opts.GetDestination(destinationName)
+		if !ok {
+			return nil, ErrDestinationNotFound
+		}
+		destinations = []backr.S3Settings{destination}
+	}
+
+	for _, destination := range destinations {
+		if _, err = s3.StatArchive(run.Archive, objects, destination); err != nil {
+			log.WithFields(logrus.Fields{
+				"project":     projectName,
+				"run_id":      run.ID,
+				"destination": destination.Name,
+				"err":         err,
+			}).Warnln("Archive not available on a destination")
+			continue
+		}
+
+		manifest, err := s3.GetManifest(ctx, run.Archive, objects, destination)
+		if err != nil {
+			return nil, err
+		}
+
+		url, err := s3.ArchiveURL(run.Archive, objects, destination)
+		if err != nil {
+			return nil, err
+		}
+
+		return &backr.ArchiveLocation{
+			Destination: destination.Name,
+			URL:         url,
+			Manifest:    manifest,
+		}, nil
+	}
+
+	return nil, fmt.Errorf("Archive not available on any destination: %v", err)
+}
+
+// getArchivedRun returns a run which has produced an archive, with its project
+func getArchivedRun(ctx context.Context, projectName string, id int) (backr.Settings, *backr.Project, backr.Run, error) {
+	opts, ok := backr.SettingsFromContext(ctx)
+	if !ok {
+		return opts, nil, backr.Run{}, fmt.Errorf("Unable to get options from context")
+	}
+
+	if opts.S3 == nil {
+		return opts, nil, backr.Run{}, fmt.Errorf("S3 is not configured")
+	}
+
+	project, err := getProject(ctx, projectName)
+	if err != nil {
+		return opts, nil, backr.Run{}, err
+	}
+
+	run, ok := project.GetRun(id)
+	if !ok {
+		return opts, project, run, ErrRunNotFound
+	}
+
+	if run.Archive == "" {
+		return opts, project, run, ErrNoArchive
+	}
+
+	return opts, project, run, nil
+}
@@ -0,0 +1,68 @@
+package throttle
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+// Reader limits the throughput of a reader with a token bucket.
+// The rate is evaluated on each read, so that it can change during a transfer.
+type Reader struct {
+	ctx    context.Context
+	reader io.Reader
+	rate   func() int64
+	tokens float64
+	last   time.Time
+}
+
+// NewReader wraps a reader. rate returns the allowed bytes per second (0 means unlimited).
+func NewReader(ctx context.Context, reader io.Reader, rate func() int64) *Reader {
+	return &Reader{
+		ctx:    ctx,
+		reader: reader,
+		rate:   rate,
+		last:   time.Now(),
+	}
+}
+
+// Read implements io.Reader, waiting as long as needed to respect the rate
+func (r *Reader) Read(p []byte) (int, error) {
+	rate := r.rate()
+	if rate <= 0 {
+		r.tokens = 0
+		r.last = time.Now()
+		return r.reader.Read(p)
+	}
+
+	// the bucket holds at most one second of transfer
+	burst := float64(rate)
+	if int64(len(p)) > rate {
+		p = p[:rate]
+	}
+
+	now := time.Now()
+	r.tokens += now.Sub(r.last).Seconds() * float64(rate)
+	if r.tokens > burst {
+		r.tokens = burst
+	}
+	r.last = now
+
+	n, err := r.reader.Read(p)
+	r.tokens -= float64(n)
+
+	if r.tokens < 0 {
+		wait := time.Duration(-r.tokens / float64(rate) * float64(time.Second))
+
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+
+		select {
+		case <-timer.C:
+		case <-r.ctx.Done():
+			return n, r.ctx.Err()
+		}
+	}
+
+	return n, err
+}
@@ -0,0 +1,111 @@
+package throttle
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// upload sends size bytes through a throttled reader to a local HTTP server, and returns the duration of the transfer
+// and the number of bytes received
+func upload(t *testing.T, ctx context.Context, size int, rate func() int64) (time.Duration, int64, error) {
+	received := make(chan int64, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n, _ := io.Copy(ioutil.Discard, r.Body)
+		received <- n
+	}))
+	defer server.Close()
+
+	body := NewReader(ctx, bytes.NewReader(make([]byte, size)), rate)
+	request, err := http.NewRequest(http.MethodPut, server.URL, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	request.ContentLength = int64(size)
+
+	start := time.Now()
+	response, err := http.DefaultClient.Do(request)
+	elapsed := time.Since(start)
+	if err != nil {
+		return elapsed, 0, err
+	}
+	response.Body.Close()
+
+	return elapsed, <-received, nil
+}
+
+func constantRate(rate int64) func() int64 {
+	return func() int64 { return rate }
+}
+
+func TestReaderLimitsThroughput(t *testing.T) {
+	const rate = 256 << 10
+
+	// the bucket starts empty: 1.5 seconds are needed to transfer 1.5 times the rate
+	elapsed, received, err := upload(t, context.Background(), rate*3/2, constantRate(rate))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if received != rate*3/2 {
+		t.Errorf("expected %d bytes, received %d", rate*3/2, received)
+	}
+	if elapsed < 1400*time.Millisecond || elapsed > 2500*time.Millisecond {
+		t.Errorf("expected about 1.5s at %d B/s, took %v", rate, elapsed)
+	}
+}
+
+func TestReaderUnlimited(t *testing.T) {
+	elapsed, received, err := upload(t, context.Background(), 8<<20, constantRate(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if received != 8<<20 {
+		t.Errorf("expected %d bytes, received %d", 8<<20, received)
+	}
+	if elapsed > time.Second {
+		t.Errorf("expected an unlimited transfer, took %v", elapsed)
+	}
+}
+
+func TestReaderFollowsRateChanges(t *testing.T) {
+	const rate = 64 << 10
+	start := time.Now()
+
+	// limited during the first second only: the whole transfer would take 10 seconds at this rate
+	elapsed, received, err := upload(t, context.Background(), rate*10, func() int64 {
+		if time.Since(start) < time.Second {
+			return rate
+		}
+		return 0
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if received != rate*10 {
+		t.Errorf("expected %d bytes, received %d", rate*10, received)
+	}
+	if elapsed < 900*time.Millisecond || elapsed > 3*time.Second {
+		t.Errorf("expected about 1s (limited, then unlimited), took %v", elapsed)
+	}
+}
+
+func TestReaderCancelled(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+
+	elapsed, _, err := upload(t, ctx, 1<<20, constantRate(64<<10))
+	if err == nil {
+		t.Fatal("expected the transfer to be cancelled")
+	}
+	if elapsed > 2*time.Second {
+		t.Errorf("expected the transfer to stop when cancelled, took %v", elapsed)
+	}
+}
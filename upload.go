@@ -15,9 +15,34 @@ func (e UploadedArchiveError) Error() string {
 }
 
 type UploadedArchiveInfo struct {
+	// Name is the object storing the archive, empty if S3 upload is not configured
 	Name   string
 	Expire time.Time
 	URL    string
+	// Destinations lists the result of the upload to each destination
+	Destinations []DestinationResult
+	// Size is the size of the archive in bytes, and SizeAnomaly tells why it is abnormal (see SizeCheckSpec)
+	Size        int64
+	SizeAnomaly string
+}
+
+// DestinationResult represents the upload of an archive to a destination
+type DestinationResult struct {
+	Destination string `json:"destination"`
+	Success     bool   `json:"success"`
+	Error       string `json:"error,omitempty"`
+}
+
+// VerifyResult represents the availability of an archive in a destination
+type VerifyResult struct {
+	Destination string `json:"destination"`
+	Archive     string `json:"archive"`
+	Available   bool   `json:"available"`
+	Size        int64  `json:"size"`
+	// Error tells why the archive is not available, or why an available archive does not match its manifest
+	Error string `json:"error,omitempty"`
+	// Manifest describes the archive, nil if it has none
+	Manifest *ArchiveManifest `json:"manifest,omitempty"`
 }
 
 func (info UploadedArchiveInfo) String() string {
@@ -25,3 +50,11 @@ func (info UploadedArchiveInfo) String() string {
 		fmt.Sprintf(" expires: %v\n", info.Expire) +
 		fmt.Sprintf("     url: %s\n", info.URL)
 }
+
+// ArchiveLocation represents where an archive can be downloaded from
+type ArchiveLocation struct {
+	Destination string `json:"destination"`
+	URL         string `json:"url"`
+	// Manifest allows to check the downloaded archive, nil if it has none
+	Manifest *ArchiveManifest `json:"manifest,omitempty"`
+}
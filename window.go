@@ -0,0 +1,104 @@
+package backr
+
+import (
+	"fmt"
+	"time"
+)
+
+// BackupWindow represents the daily period when scheduled backups are allowed to start
+type BackupWindow struct {
+	Start string `yaml:"start"` // like "22:00"
+	End   string `yaml:"end"`   // like "05:00", can be before Start for windows spanning midnight
+	// CancelAtEnd cancels the backups still running when the window ends
+	CancelAtEnd bool `yaml:"cancel_at_end"`
+}
+
+// ParseBackupWindow parses a window formatted like "22:00-05:00"
+func ParseBackupWindow(value string) (BackupWindow, error) {
+	var window BackupWindow
+	if len(value) != len("00:00-00:00") || value[5] != '-' {
+		return window, fmt.Errorf("window must be formatted like '22:00-05:00'")
+	}
+
+	window.Start = value[:5]
+	window.End = value[6:]
+
+	return window, window.Validate()
+}
+
+// Validate returns an error if the bounds of the window are not valid
+func (w BackupWindow) Validate() error {
+	if _, err := parseClock(w.Start); err != nil {
+		return fmt.Errorf("window start: %v", err)
+	}
+	if _, err := parseClock(w.End); err != nil {
+		return fmt.Errorf("window end: %v", err)
+	}
+	return nil
+}
+
+func (w BackupWindow) String() string {
+	return w.Start + "-" + w.End
+}
+
+// Contains returns true if t is inside the window, in the given time zone
+func (w BackupWindow) Contains(t time.Time, location *time.Location) bool {
+	start, end := w.bounds()
+	if start == end {
+		// the window is open all day long
+		return true
+	}
+
+	t = t.In(location)
+	minutes := t.Hour()*60 + t.Minute()
+
+	if start < end {
+		return minutes >= start && minutes < end
+	}
+
+	// the window spans midnight
+	return minutes >= start || minutes < end
+}
+
+// NextStart returns t if it is inside the window, or the next opening of the window otherwise
+func (w BackupWindow) NextStart(t time.Time, location *time.Location) time.Time {
+	if w.Contains(t, location) {
+		return t
+	}
+
+	start, _ := w.bounds()
+	return nextClock(t, start, location)
+}
+
+// EndOf returns the closing time of the window containing t
+func (w BackupWindow) EndOf(t time.Time, location *time.Location) time.Time {
+	_, end := w.bounds()
+	return nextClock(t, end, location)
+}
+
+// bounds returns the start and the end of the window, in minutes since midnight
+func (w BackupWindow) bounds() (int, int) {
+	// the window is validated when it is parsed
+	start, _ := parseClock(w.Start)
+	end, _ := parseClock(w.End)
+	return start, end
+}
+
+// nextClock returns the first time after t where the wall clock displays the given minutes since midnight
+func nextClock(t time.Time, minutes int, location *time.Location) time.Time {
+	t = t.In(location)
+	date := time.Date(t.Year(), t.Month(), t.Day(), minutes/60, minutes%60, 0, 0, location)
+	if !date.After(t) {
+		date = time.Date(t.Year(), t.Month(), t.Day()+1, minutes/60, minutes%60, 0, 0, location)
+	}
+	return date
+}
+
+// parseClock parses a time like "22:00" into minutes since midnight
+func parseClock(value string) (int, error) {
+	parsed, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("'%s' must be formatted like '22:00'", value)
+	}
+	return parsed.Hour()*60 + parsed.Minute(), nil
+}